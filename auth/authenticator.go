@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zhayt/user-service/config"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// _knownDefaults are credentials that have been published in example
+// configuration and must never be accepted.
+var _knownDefaults = map[string]struct{}{
+	"dev-secret":      {},
+	"dev-gateway-key": {},
+	"secret":          {},
+	"changeme":        {},
+}
+
+type apiKey struct {
+	name string
+	key  []byte
+	role string
+}
+
+// Authenticator resolves bearer tokens and API keys to caller identities.
+// Bearer tokens are HS256 JWTs whose subject is the user id; API keys are
+// configured per service.
+type Authenticator struct {
+	jwtSecret []byte
+	jwtIssuer string
+	keys      []apiKey
+}
+
+type claims struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// NewAuthenticator refuses an empty JWT secret and any secret or API key
+// known from example configuration.
+func NewAuthenticator(cfg *config.Config) (*Authenticator, error) {
+	if cfg.AuthJWTSecret == "" {
+		return nil, errors.New("cannot create authenticator: AUTH_JWT_SECRET is not set")
+	}
+	if _, ok := _knownDefaults[cfg.AuthJWTSecret]; ok {
+		return nil, errors.New("cannot create authenticator: AUTH_JWT_SECRET is a published default")
+	}
+
+	a := &Authenticator{jwtSecret: []byte(cfg.AuthJWTSecret), jwtIssuer: cfg.AuthJWTIssuer}
+
+	for name, key := range cfg.AuthServiceKeys {
+		a.keys = append(a.keys, apiKey{name: name, key: []byte(key), role: RoleService})
+	}
+	for name, key := range cfg.AuthAdminKeys {
+		a.keys = append(a.keys, apiKey{name: name, key: []byte(key), role: RoleAdmin})
+	}
+
+	for _, k := range a.keys {
+		if _, ok := _knownDefaults[string(k.key)]; ok {
+			return nil, fmt.Errorf("cannot create authenticator: the API key of %q is a published default", k.name)
+		}
+	}
+
+	return a, nil
+}
+
+// Authenticate checks the value of an Authorization header ("Bearer ...")
+// and of an API key header. Either may be empty.
+func (a *Authenticator) Authenticate(authorization, key string) (*Identity, error) {
+	if key != "" {
+		return a.authenticateKey(key)
+	}
+
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	return a.authenticateToken(token)
+}
+
+func (a *Authenticator) authenticateKey(key string) (*Identity, error) {
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(k.key, []byte(key)) == 1 {
+			return &Identity{Subject: k.name, Role: k.role}, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+func (a *Authenticator) authenticateToken(token string) (*Identity, error) {
+	opts := []jwt.ParserOption{jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithExpirationRequired()}
+	if a.jwtIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.jwtIssuer))
+	}
+
+	var c claims
+	if _, err := jwt.ParseWithClaims(token, &c, func(*jwt.Token) (interface{}, error) {
+		return a.jwtSecret, nil
+	}, opts...); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+	}
+
+	userID, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil || userID == 0 {
+		return nil, fmt.Errorf("%w: subject is not a user id", ErrInvalidCredentials)
+	}
+
+	role := c.Role
+	if role == "" {
+		role = RoleUser
+	}
+	if role != RoleUser && role != RoleAdmin {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidCredentials, role)
+	}
+
+	return &Identity{Subject: c.Subject, UserID: userID, Email: c.Email, Role: role}, nil
+}
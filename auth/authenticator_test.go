@@ -0,0 +1,43 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/config"
+)
+
+func TestNewAuthenticatorRefusesUnsafeSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr bool
+	}{
+		{name: "empty secret", cfg: config.Config{}, wantErr: true},
+		{name: "default secret", cfg: config.Config{AuthJWTSecret: "dev-secret"}, wantErr: true},
+		{
+			name: "default service key",
+			cfg: config.Config{
+				AuthJWTSecret:   "9c1e4b7f0d2a",
+				AuthServiceKeys: map[string]string{"forum-gateway": "dev-gateway-key"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "configured",
+			cfg: config.Config{
+				AuthJWTSecret:   "9c1e4b7f0d2a",
+				AuthServiceKeys: map[string]string{"forum-gateway": "5f3a8e21"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.NewAuthenticator(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import "context"
+
+// Roles a caller can have. They are ordered: each role may do everything
+// the previous ones may.
+const (
+	RoleUser    = "user"
+	RoleService = "service"
+	RoleAdmin   = "admin"
+)
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Subject names the caller: the user id for user tokens, the key or
+	// certificate name for services.
+	Subject string
+	// UserID and Email are set for end users acting on their own account.
+	UserID uint64
+	Email  string
+	Role   string
+}
+
+func (i *Identity) IsAdmin() bool {
+	return i != nil && i.Role == RoleAdmin
+}
+
+// IsService reports whether the caller is a trusted service or an admin.
+func (i *Identity) IsService() bool {
+	return i != nil && (i.Role == RoleService || i.Role == RoleAdmin)
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the caller identity, or nil for anonymous calls.
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
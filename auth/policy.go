@@ -0,0 +1,43 @@
+package auth
+
+// Policy is the access level a method requires.
+type Policy int
+
+const (
+	// Admin is the zero value, so methods missing from the table are
+	// denied to everyone but admins.
+	Admin Policy = iota
+	// Public methods need no credentials.
+	Public
+	// Self methods may be called by the user the request targets, and by
+	// services and admins.
+	Self
+	// Service methods may be called by trusted services and admins.
+	Service
+)
+
+// Policies maps full gRPC method names to their access policy.
+var Policies = map[string]Policy{
+	"/micro_forum_proto.UserService/CreateUser":         Public,
+	"/micro_forum_proto.UserService/GetUserByID":        Service,
+	"/micro_forum_proto.UserService/GetUserByEmail":     Service,
+	"/micro_forum_proto.UserService/UpdateUserPassword": Self,
+	"/micro_forum_proto.UserService/UpdateUserName":     Self,
+
+	"/micro_forum_proto.UserService/UpdateUserPasswordByID": Self,
+	"/micro_forum_proto.UserService/UpdateUserNameByID":     Self,
+	"/micro_forum_proto.UserService/RecordLogin":            Service,
+
+	"/micro_forum_proto.UserService/CreateWebhook":            Admin,
+	"/micro_forum_proto.UserService/ListWebhooks":             Admin,
+	"/micro_forum_proto.UserService/DeleteWebhook":            Admin,
+	"/micro_forum_proto.UserService/ListWebhookDeadLetters":   Admin,
+	"/micro_forum_proto.UserService/ReplayWebhookDeadLetters": Admin,
+
+	"/user.v2.UserService/GetUser":        Self,
+	"/user.v2.UserService/CreateUser":     Public,
+	"/user.v2.UserService/UpdateUser":     Self,
+	"/user.v2.UserService/ChangePassword": Self,
+
+	"/grpc.health.v1.Health/Check": Public,
+}
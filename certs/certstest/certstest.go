@@ -0,0 +1,157 @@
+// Package certstest issues throwaway certificates for tests of TLS and
+// mutual TLS listeners.
+package certstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Files are the PEM files of a server certificate for localhost and of the
+// CA that issued it and the client certificates.
+type Files struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// Roots trusts the CA, for clients verifying the server.
+	Roots *x509.CertPool
+
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+}
+
+// Write issues a CA and a server certificate and writes them to a temporary
+// directory removed when the test ends.
+func Write(t testing.TB) *Files {
+	t.Helper()
+
+	caKey := newKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create ca: %v", err)
+	}
+
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("parse ca: %v", err)
+	}
+
+	f := &Files{Roots: x509.NewCertPool(), ca: ca, caKey: caKey}
+	f.Roots.AddCert(ca)
+
+	serverKey := newKey(t)
+	serverDER := f.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, serverKey)
+
+	dir := t.TempDir()
+	f.CertFile = writePEM(t, dir, "server.pem", "CERTIFICATE", serverDER)
+	f.KeyFile = writePEM(t, dir, "server-key.pem", "EC PRIVATE KEY", marshalKey(t, serverKey))
+	f.ClientCAFile = writePEM(t, dir, "ca.pem", "CERTIFICATE", caDER)
+
+	return f
+}
+
+// Client issues a client certificate with the given subject common name.
+func (f *Files) Client(t testing.TB, commonName string) tls.Certificate {
+	t.Helper()
+
+	key := newKey(t)
+	der := f.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, key)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// ClientConfig trusts the server and presents a client certificate for
+// commonName unless it is empty.
+func (f *Files) ClientConfig(t testing.TB, commonName string, nextProtos ...string) *tls.Config {
+	t.Helper()
+
+	cfg := &tls.Config{RootCAs: f.Roots, NextProtos: nextProtos}
+	if commonName != "" {
+		cfg.Certificates = []tls.Certificate{f.Client(t, commonName)}
+	}
+
+	return cfg
+}
+
+func (f *Files) issue(t testing.TB, template *x509.Certificate, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatalf("serial number: %v", err)
+	}
+
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, f.ca, &key.PublicKey, f.caKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	return der
+}
+
+func newKey(t testing.TB) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	return key
+}
+
+func marshalKey(t testing.TB, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	return der
+}
+
+func writePEM(t testing.TB, dir, name, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+
+	return path
+}
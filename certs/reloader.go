@@ -0,0 +1,149 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"go.uber.org/zap"
+)
+
+// Reloader keeps the server certificate and client CA pool in sync with the
+// files on disk. Handshakes always use the latest successfully loaded
+// material, so rotating certificates needs no restart.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	interval     time.Duration
+
+	current atomic.Pointer[tls.Config]
+	// contents of the files as last loaded, to detect changes
+	loaded [][]byte
+	l      *zap.Logger
+}
+
+func NewReloader(cfg *config.Config, l *zap.Logger) (*Reloader, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, errors.New("tls cert and key files are required")
+	}
+
+	r := &Reloader{
+		certFile:     cfg.TLSCertFile,
+		keyFile:      cfg.TLSKeyFile,
+		clientCAFile: cfg.TLSClientCAFile,
+		interval:     cfg.TLSReloadInterval,
+		l:            l,
+	}
+
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// TLSConfig returns a server config that resolves the current certificates
+// on every handshake. nextProtos are the ALPN protocols offered: "h2" for
+// gRPC, plus "http/1.1" for HTTP listeners.
+func (r *Reloader) TLSConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			// ALPN is negotiated from the config returned here, not the outer one
+			current := r.current.Load().Clone()
+			current.NextProtos = nextProtos
+			return current, nil
+		},
+	}
+}
+
+// Run checks the files for changes every interval until ctx is cancelled.
+// A broken update is logged and the previous certificates stay in use.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.reload()
+			if err != nil {
+				r.l.Error("cannot reload tls certificates", zap.Error(err))
+				continue
+			}
+			if changed {
+				r.l.Info("tls certificates reloaded")
+			}
+		}
+	}
+}
+
+func (r *Reloader) reload() (bool, error) {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+
+	contents := make([][]byte, len(files))
+	for i, name := range files {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return false, fmt.Errorf("cannot read %s: %w", name, err)
+		}
+		contents[i] = b
+	}
+
+	if r.unchanged(contents) {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return false, fmt.Errorf("cannot parse key pair: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if r.clientCAFile != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(contents[2]) {
+			return false, fmt.Errorf("no certificates found in %s", r.clientCAFile)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.current.Store(tlsConfig)
+	r.loaded = contents
+
+	return true, nil
+}
+
+func (r *Reloader) unchanged(contents [][]byte) bool {
+	if len(r.loaded) != len(contents) {
+		return false
+	}
+
+	for i := range contents {
+		if !bytes.Equal(r.loaded[i], contents[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,157 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/certs"
+	"github.com/zhayt/user-service/certs/certstest"
+	"github.com/zhayt/user-service/config"
+	"go.uber.org/zap"
+)
+
+func newReloader(t *testing.T, files *certstest.Files) *certs.Reloader {
+	t.Helper()
+
+	r, err := certs.NewReloader(&config.Config{
+		TLSCertFile:       files.CertFile,
+		TLSKeyFile:        files.KeyFile,
+		TLSClientCAFile:   files.ClientCAFile,
+		TLSReloadInterval: 10 * time.Millisecond,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+
+	return r
+}
+
+// handshake serves one TLS handshake with serverConfig and returns the
+// client's view of the connection.
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer lis.Close()
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// hold the connection open until the client is done with it
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), clientConfig)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	// TLS 1.3 reports a rejected client certificate on the first read
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			return tls.ConnectionState{}, err
+		}
+	}
+
+	return conn.ConnectionState(), nil
+}
+
+func TestTLSConfigNegotiatesALPN(t *testing.T) {
+	files := certstest.Write(t)
+	r := newReloader(t, files)
+
+	tests := []struct {
+		name   string
+		server []string
+		client []string
+		want   string
+	}{
+		{name: "grpc", server: []string{"h2"}, client: []string{"h2"}, want: "h2"},
+		{name: "http2", server: []string{"h2", "http/1.1"}, client: []string{"h2", "http/1.1"}, want: "h2"},
+		{name: "http1", server: []string{"h2", "http/1.1"}, client: []string{"http/1.1"}, want: "http/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := handshake(t, r.TLSConfig(tt.server...), files.ClientConfig(t, "forum-gateway", tt.client...))
+			if err != nil {
+				t.Fatalf("handshake: %v", err)
+			}
+
+			if state.NegotiatedProtocol != tt.want {
+				t.Errorf("negotiated %q, want %q", state.NegotiatedProtocol, tt.want)
+			}
+		})
+	}
+}
+
+func TestTLSConfigRequiresClientCertificate(t *testing.T) {
+	files := certstest.Write(t)
+	r := newReloader(t, files)
+
+	if _, err := handshake(t, r.TLSConfig("h2"), files.ClientConfig(t, "", "h2")); err == nil {
+		t.Error("handshake without a client certificate succeeded")
+	}
+
+	// a certificate from another CA is rejected too
+	other := certstest.Write(t)
+	clientConfig := files.ClientConfig(t, "", "h2")
+	clientConfig.Certificates = []tls.Certificate{other.Client(t, "forum-gateway")}
+
+	if _, err := handshake(t, r.TLSConfig("h2"), clientConfig); err == nil {
+		t.Error("handshake with a foreign client certificate succeeded")
+	}
+}
+
+func TestRunReloadsChangedCertificates(t *testing.T) {
+	files := certstest.Write(t)
+	r := newReloader(t, files)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	// rotate to a certificate from a new CA
+	rotated := certstest.Write(t)
+	for _, pair := range [][2]string{
+		{rotated.CertFile, files.CertFile},
+		{rotated.KeyFile, files.KeyFile},
+		{rotated.ClientCAFile, files.ClientCAFile},
+	} {
+		b, err := os.ReadFile(pair[0])
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if err := os.WriteFile(pair[1], b, 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	// the client trusts only the new CA and presents a certificate from it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := handshake(t, r.TLSConfig("h2"), rotated.ClientConfig(t, "forum-gateway", "h2"))
+		if err == nil {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("rotated certificates not in use: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,21 +1,48 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/certs"
 	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/gateway"
+	"github.com/zhayt/user-service/gql"
+	"github.com/zhayt/user-service/health"
+	"github.com/zhayt/user-service/interceptor"
 	"github.com/zhayt/user-service/logger"
+	"github.com/zhayt/user-service/metrics"
 	pb "github.com/zhayt/user-service/proto"
+	userv2 "github.com/zhayt/user-service/proto/user/v2"
 	"github.com/zhayt/user-service/service"
 	"github.com/zhayt/user-service/storage"
+	"github.com/zhayt/user-service/storage/cache"
+	"github.com/zhayt/user-service/storage/migrate"
 	"github.com/zhayt/user-service/storage/postgre"
+	"github.com/zhayt/user-service/storage/sqlite"
+	"github.com/zhayt/user-service/tracing"
+	"github.com/zhayt/user-service/web"
+	"github.com/zhayt/user-service/webhook"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 )
 
+const _inprocessBufferSize = 1 << 20
+
 func main() {
 	if err := run(); err != nil {
 		log.Fatal(err)
@@ -38,52 +65,405 @@ func run() error {
 		return err
 	}
 
-	defer func(logger2 *zap.Logger) {
-		err := l.Sync()
-		if err != nil {
-			log.Fatalln(err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return runMigrate(context.Background(), cfg, l, os.Args[2:])
+	}
+
+	// syncing a console logger fails with EINVAL; nothing is lost then
+	defer func() { _ = l.Sync() }()
+
+	// tracing
+	shutdownTracing, err := tracing.Init(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			l.Error("tracing shutdown", zap.Error(err))
 		}
-	}(l)
+	}()
+
+	// background workers stop only after the servers have drained, so
+	// in-flight calls can still publish webhooks and reach the database
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
 
 	// repo
 
-	db, err := postgre.Dial(makeDSN(cfg))
+	repo, db, closeDB, err := openStorage(workersCtx, &workers, cfg, l)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	defer closeDB()
+
+	if cfg.CacheEnabled {
+		lru := cache.NewLRU(cfg.CacheSize)
+		if err := metrics.RegisterCacheSize(lru.Len); err != nil {
+			return err
+		}
+
+		repo = repo.WithCache(lru, cfg)
+	}
 
-	repo := storage.NewStorage(db, l)
+	// webhooks
+	dispatcher := webhook.NewDispatcher(repo, &http.Client{Timeout: cfg.WebhookTimeout}, cfg, l)
+	startWorker(&workers, func() { dispatcher.Run(workersCtx) })
 
 	// usecases
-	validate := service.NewValidateService()
-	userService := service.NewUserService(repo, validate, l)
+	validate, err := service.NewValidateService()
+	if err != nil {
+		return err
+	}
+
+	userService := service.NewUserService(repo, validate, dispatcher, cfg, l)
 
 	// init
 	lis, err := net.Listen("tcp", net.JoinHostPort("", cfg.AppPort))
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	authenticator, err := auth.NewAuthenticator(cfg)
+	if err != nil {
+		return err
+	}
+
+	var reloader *certs.Reloader
+	if cfg.TLSCertFile != "" {
+		reloader, err = certs.NewReloader(cfg, l)
+		if err != nil {
+			return err
+		}
+		startWorker(&workers, func() { reloader.Run(workersCtx) })
 	}
 
-	var opts []grpc.ServerOption
-	grpcServer := grpc.NewServer(opts...)
+	grpcServer, inprocessServer := newGRPCServers(cfg, authenticator, reloader, l)
 
 	reflection.Register(grpcServer)
 
 	// register
 
-	pb.RegisterUserServiceServer(grpcServer, userService)
+	registerServices(userService, grpcServer, inprocessServer)
+
+	checker := health.NewChecker(db, cfg, l,
+		pb.UserService_ServiceDesc.ServiceName, userv2.UserService_ServiceDesc.ServiceName)
+	checker.Register(grpcServer)
+	startWorker(&workers, func() { checker.Run(workersCtx) })
+
+	// metrics and probes
+	opsMux := http.NewServeMux()
+	opsMux.Handle("/metrics", metrics.Handler())
+	opsMux.HandleFunc("/healthz", checker.Healthz)
+	opsMux.HandleFunc("/readyz", checker.Readyz)
+
+	// probes stay plaintext for the orchestrator; they expose no user data
+	metricsServer := &http.Server{
+		Addr:              net.JoinHostPort("", cfg.MetricsPort),
+		Handler:           opsMux,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
+
+	apiServers, closeAPI, err := newAPIServers(workersCtx, grpcServer, inprocessServer, userService, authenticator, reloader, cfg, l)
+	if err != nil {
+		return err
+	}
+	defer closeAPI()
+
+	go serveHTTP(metricsServer, l)
+	for _, srv := range apiServers {
+		go serveHTTP(srv, l)
+	}
 
 	//Start GRPC server
-	log.Printf("Start GRPC server on address: %s", cfg.AppPort)
-	err = grpcServer.Serve(lis)
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Start GRPC server on address: %s", cfg.AppPort)
+		serveErr <- grpcServer.Serve(lis)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err = <-serveErr:
+		l.Error("Serve", zap.Error(err))
+	case <-ctx.Done():
+		l.Info("shutdown signal received, draining")
+	}
+
+	shutdown(checker, metricsServer, apiServers, []*grpc.Server{grpcServer, inprocessServer}, stopWorkers, &workers, cfg, l)
+
+	// deferred: db.Close, tracing flush, logger sync
+	l.Info("shutdown complete")
+	return err
+}
+
+// newGRPCServers returns the public gRPC server and an in-process one that
+// serves the REST gateway. Both run the same interceptors; only the public
+// one has TLS credentials, since the gateway holds no client certificate.
+func newGRPCServers(cfg *config.Config, authenticator *auth.Authenticator, reloader *certs.Reloader, l *zap.Logger) (*grpc.Server, *grpc.Server) {
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		interceptor.Unary(cfg, authenticator, l),
+	}
+
+	inprocess := grpc.NewServer(opts...)
+
+	if reloader != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.TLSConfig("h2"))))
+	}
+
+	return grpc.NewServer(opts...), inprocess
+}
+
+func registerServices(users *service.UserService, servers ...*grpc.Server) {
+	usersV2 := service.NewUserServiceV2(users)
+
+	for _, srv := range servers {
+		pb.RegisterUserServiceServer(srv, users)
+		userv2.RegisterUserServiceServer(srv, usersV2)
+	}
+}
+
+// newAPIServers builds the REST gateway, the Connect and gRPC-Web server and
+// the optional GraphQL server, and starts serving inprocess for the gateway.
+// With TLS configured they require the same certificates as the gRPC port,
+// so none of them is a plaintext way around it. The returned func closes
+// the gateway's connection.
+func newAPIServers(ctx context.Context, grpcServer, inprocess *grpc.Server, users *service.UserService, authenticator *auth.Authenticator, reloader *certs.Reloader, cfg *config.Config, l *zap.Logger) ([]*http.Server, func(), error) {
+	// REST gateway, talking to the grpc server in-process
+	lis := bufconn.Listen(_inprocessBufferSize)
+	go func() {
+		if err := inprocess.Serve(lis); err != nil {
+			l.Error("in-process Serve", zap.Error(err))
+		}
+	}()
+
+	gwConn, err := gateway.Dial(ctx, lis)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeConn := func() { gwConn.Close() }
+
+	gw, err := gateway.NewServer(ctx, gwConn, cfg, l)
+	if err != nil {
+		closeConn()
+		return nil, nil, err
+	}
+
+	// Connect and gRPC-Web for browser clients
+	webServer, err := web.NewServer(grpcServer, cfg, l)
+	if err != nil {
+		closeConn()
+		return nil, nil, err
+	}
+
+	servers := []*http.Server{gw, webServer}
+
+	// optional GraphQL read API
+	if cfg.GraphQLPort != "" {
+		servers = append(servers, gql.NewServer(users, authenticator, cfg, l))
+	}
+
+	if reloader != nil {
+		for _, srv := range servers {
+			srv.TLSConfig = reloader.TLSConfig("h2", "http/1.1")
+		}
+	}
+
+	return servers, closeConn, nil
+}
+
+// openStorage connects the configured backend and, with MigrateOnStart,
+// applies pending migrations. Upkeep such as replica health checks runs on
+// workers until ctx is cancelled. The returned pinger is nil for backends
+// without a connection to check.
+func openStorage(ctx context.Context, workers *sync.WaitGroup, cfg *config.Config, l *zap.Logger) (*storage.Storage, health.Pinger, func(), error) {
+	if cfg.StorageBackend == storage.BackendMemory {
+		return storage.NewMemoryStorage(l), nil, func() {}, nil
+	}
+
+	db, migrator, err := openDB(cfg, l)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if cfg.MigrateOnStart {
+		if _, err := migrator.Up(ctx); err != nil {
+			db.Close()
+			return nil, nil, nil, err
+		}
+	}
+
+	if cfg.StorageBackend == storage.BackendSQLite {
+		if err := metrics.RegisterDB(db, storage.BackendSQLite); err != nil {
+			db.Close()
+			return nil, nil, nil, err
+		}
+
+		return storage.NewSQLiteStorage(db, cfg, l), db, func() { db.Close() }, nil
+	}
+
+	replicas, err := postgre.OpenReplicas(db, cfg, l)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+
+	closeDB := func() {
+		replicas.Close()
+		db.Close()
+	}
+
+	if err := metrics.RegisterDB(db, cfg.DBName); err != nil {
+		closeDB()
+		return nil, nil, nil, err
+	}
+
+	for i, pool := range replicas.Pools() {
+		if err := metrics.RegisterDB(pool, fmt.Sprintf("%s_replica%d", cfg.DBName, i)); err != nil {
+			closeDB()
+			return nil, nil, nil, err
+		}
+	}
+
+	startWorker(workers, func() { replicas.Run(ctx) })
+
+	return storage.NewStorage(db, replicas, cfg, l), db, closeDB, nil
+}
+
+// openDB connects a SQL backend and returns its migrator.
+func openDB(cfg *config.Config, l *zap.Logger) (*sqlx.DB, *migrate.Migrator, error) {
+	var (
+		db          *sqlx.DB
+		newMigrator func(*sqlx.DB, *zap.Logger) (*migrate.Migrator, error)
+		err         error
+	)
+
+	switch cfg.StorageBackend {
+	case storage.BackendPostgres:
+		db, err = postgre.Dial(makeDSN(cfg), cfg, l)
+		newMigrator = postgre.NewMigrator
+	case storage.BackendSQLite:
+		db, err = sqlite.Open(cfg.SQLiteDSN, cfg, l)
+		newMigrator = sqlite.NewMigrator
+	default:
+		return nil, nil, fmt.Errorf("storage backend %q has no database", cfg.StorageBackend)
+	}
+
 	if err != nil {
-		l.Fatal("Serve", zap.Error(err))
+		return nil, nil, err
 	}
-	return nil
+
+	migrator, err := newMigrator(db, l)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return db, migrator, nil
 }
 
 func makeDSN(cfg *config.Config) string {
 	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=%s",
 		cfg.DBHost, cfg.DBUser, cfg.DBPassword, cfg.DBName, cfg.DBPort, cfg.TZ)
 }
+
+func startWorker(wg *sync.WaitGroup, run func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		run()
+	}()
+}
+
+func serveHTTP(srv *http.Server, l *zap.Logger) {
+	log.Printf("Start HTTP server on address: %s", srv.Addr)
+
+	var err error
+	if srv.TLSConfig != nil {
+		// the certificates come from srv.TLSConfig, not from files
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		l.Error("ListenAndServe", zap.String("addr", srv.Addr), zap.Error(err))
+	}
+}
+
+// shutdown drains the process in order: readiness goes NOT_SERVING first
+// and the servers keep serving for cfg.ShutdownPropagationDelay, so load
+// balancers stop routing here. The API servers then finish their in-flight
+// calls until cfg.ShutdownTimeout, all HTTP servers at once and then all
+// gRPC servers at once, since the HTTP servers forward calls to the gRPC
+// ones. The background workers stop next so those calls can still publish
+// webhooks and reach the database, and metricsServer, which serves the
+// probes, stops last.
+func shutdown(checker *health.Checker, metricsServer *http.Server, httpServers []*http.Server, grpcServers []*grpc.Server, stopWorkers func(), workers *sync.WaitGroup, cfg *config.Config, l *zap.Logger) {
+	checker.Shutdown()
+	time.Sleep(cfg.ShutdownPropagationDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range httpServers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			shutdownHTTP(ctx, srv, l)
+		}(srv)
+	}
+	wg.Wait()
+
+	for _, srv := range grpcServers {
+		wg.Add(1)
+		go func(srv *grpc.Server) {
+			defer wg.Done()
+			gracefulStop(ctx, srv, l)
+		}(srv)
+	}
+	wg.Wait()
+
+	stopWorkers()
+	workers.Wait()
+
+	shutdownHTTP(ctx, metricsServer, l)
+}
+
+// shutdownHTTP waits for in-flight requests to finish and closes the
+// remaining connections once ctx expires.
+func shutdownHTTP(ctx context.Context, srv *http.Server, l *zap.Logger) {
+	err := srv.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		l.Warn("http server shutdown deadline exceeded, closing remaining connections", zap.String("addr", srv.Addr))
+		err = srv.Close()
+	}
+	if err != nil {
+		l.Error("http server shutdown", zap.String("addr", srv.Addr), zap.Error(err))
+	}
+}
+
+// gracefulStop waits for in-flight RPCs to finish and forces the remaining
+// ones closed once ctx expires.
+func gracefulStop(ctx context.Context, srv *grpc.Server, l *zap.Logger) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		l.Warn("graceful stop deadline exceeded, closing remaining connections")
+		srv.Stop()
+		<-stopped
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/health"
+	pb "github.com/zhayt/user-service/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// blockingUsers holds GetUserByID calls until release is closed.
+type blockingUsers struct {
+	pb.UnimplementedUserServiceServer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingUsers) GetUserByID(context.Context, *pb.GetUserByIDReq) (*pb.User, error) {
+	s.entered <- struct{}{}
+	<-s.release
+	return &pb.User{Id: 1}, nil
+}
+
+// process is the part of run() that shutdown drains: a gRPC server, an
+// HTTP server and a background worker, each with a call in flight, and the
+// metrics server serving the probes.
+type process struct {
+	checker       *health.Checker
+	grpcServer    *grpc.Server
+	httpServer    *http.Server
+	httpURL       string
+	metricsServer *http.Server
+	metricsURL    string
+	stopWorkers   context.CancelFunc
+	workers       sync.WaitGroup
+	// workerStopped is set when the background worker returns
+	workerStopped atomic.Bool
+
+	users   *blockingUsers
+	grpcErr chan error
+	httpErr chan error
+}
+
+func startProcess(t *testing.T) *process {
+	t.Helper()
+
+	l := zap.NewNop()
+	p := &process{
+		users:   &blockingUsers{entered: make(chan struct{}, 2), release: make(chan struct{})},
+		grpcErr: make(chan error, 1),
+		httpErr: make(chan error, 1),
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	p.stopWorkers = stopWorkers
+
+	cfg := &config.Config{HealthCheckInterval: time.Hour, HealthCheckTimeout: time.Second}
+	p.checker = health.NewChecker(nil, cfg, l, pb.UserService_ServiceDesc.ServiceName)
+	startWorker(&p.workers, func() { p.checker.Run(workersCtx) })
+	startWorker(&p.workers, func() {
+		<-workersCtx.Done()
+		p.workerStopped.Store(true)
+	})
+
+	p.grpcServer = grpc.NewServer()
+	pb.RegisterUserServiceServer(p.grpcServer, p.users)
+
+	lis := bufconn.Listen(_inprocessBufferSize)
+	go func() { _ = p.grpcServer.Serve(lis) }()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	// only /slow waits for release
+	p.httpServer = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			p.users.entered <- struct{}{}
+			<-p.users.release
+		}
+		_, _ = w.Write([]byte("ok"))
+	})}
+	p.httpURL = "http://" + httpLis.Addr().String()
+	go func() { _ = p.httpServer.Serve(httpLis) }()
+
+	metricsLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	p.metricsServer = &http.Server{Handler: http.HandlerFunc(p.checker.Readyz)}
+	p.metricsURL = "http://" + metricsLis.Addr().String()
+	go func() { _ = p.metricsServer.Serve(metricsLis) }()
+	t.Cleanup(func() { p.metricsServer.Close() })
+
+	// one call in flight on each server
+	go func() {
+		_, err := pb.NewUserServiceClient(conn).GetUserByID(context.Background(), &pb.GetUserByIDReq{Id: 1})
+		p.grpcErr <- err
+	}()
+	go func() {
+		resp, err := http.Get(p.httpURL + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+		p.httpErr <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-p.users.entered:
+		case <-time.After(5 * time.Second):
+			t.Fatal("calls did not reach the handlers")
+		}
+	}
+
+	return p
+}
+
+// shutdown runs the production shutdown sequence in the background.
+func (p *process) shutdown(delay, timeout time.Duration) <-chan struct{} {
+	cfg := &config.Config{ShutdownPropagationDelay: delay, ShutdownTimeout: timeout}
+
+	done := make(chan struct{})
+	go func() {
+		shutdown(p.checker, p.metricsServer, []*http.Server{p.httpServer}, []*grpc.Server{p.grpcServer}, p.stopWorkers, &p.workers, cfg, zap.NewNop())
+		close(done)
+	}()
+
+	return done
+}
+
+// get returns the status of a GET to url, or 0 when it fails.
+func get(url string) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func (p *process) ready() bool {
+	rec := httptest.NewRecorder()
+	p.checker.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rec.Code == http.StatusOK
+}
+
+func TestShutdownDrainsInFlightCalls(t *testing.T) {
+	p := startProcess(t)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("checker never became ready")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	done := p.shutdown(0, time.Minute)
+
+	// readiness drops right away while the calls are still running
+	deadline = time.Now().Add(5 * time.Second)
+	for p.ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("checker still ready after shutdown started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("shutdown returned with calls in flight")
+	default:
+	}
+
+	if p.workerStopped.Load() {
+		t.Fatal("workers stopped before in-flight calls finished")
+	}
+
+	if code := get(p.metricsURL); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz while draining: %d, want 503 from a running metrics server", code)
+	}
+
+	close(p.users.release)
+
+	if err := <-p.grpcErr; err != nil {
+		t.Errorf("in-flight gRPC call failed: %v", err)
+	}
+
+	if err := <-p.httpErr; err != nil {
+		t.Errorf("in-flight HTTP call failed: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not return after the calls finished")
+	}
+
+	if !p.workerStopped.Load() {
+		t.Error("workers still running after shutdown")
+	}
+
+	if code := get(p.metricsURL); code != 0 {
+		t.Errorf("metrics server still answers after shutdown: %d", code)
+	}
+}
+
+func TestShutdownKeepsServingWhileReadinessPropagates(t *testing.T) {
+	p := startProcess(t)
+	defer close(p.users.release)
+
+	delay := 200 * time.Millisecond
+	start := time.Now()
+	done := p.shutdown(delay, time.Minute)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("checker still ready after shutdown started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// new calls are still served until the load balancers have noticed
+	if code := get(p.httpURL); code != http.StatusOK {
+		t.Errorf("new request during the propagation delay: %d, want 200", code)
+	}
+	if code := get(p.metricsURL); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz during the propagation delay: %d, want 503", code)
+	}
+
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Fatalf("checks took %v, longer than the %v delay", elapsed, delay)
+	}
+
+	time.Sleep(delay)
+	if code := get(p.httpURL); code != 0 {
+		t.Errorf("new request after the propagation delay: %d, want refused", code)
+	}
+
+	select {
+	case <-done:
+		t.Fatal("shutdown returned with calls in flight")
+	default:
+	}
+}
+
+func TestShutdownForcesStopAfterTimeout(t *testing.T) {
+	p := startProcess(t)
+	defer close(p.users.release)
+
+	timeout := 100 * time.Millisecond
+	start := time.Now()
+
+	select {
+	case <-p.shutdown(0, timeout):
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown ignored its timeout")
+	}
+
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("shutdown returned after %v, before its %v timeout", elapsed, timeout)
+	}
+
+	if err := <-p.grpcErr; status.Code(err) != codes.Unavailable {
+		t.Errorf("in-flight gRPC call: %v, want Unavailable", err)
+	}
+
+	// the HTTP connection is closed rather than left to the handler
+	if err := <-p.httpErr; err == nil {
+		t.Error("in-flight HTTP call succeeded, want its connection closed")
+	}
+
+	if !p.workerStopped.Load() {
+		t.Error("workers still running after shutdown")
+	}
+}
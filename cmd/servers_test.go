@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/certs"
+	"github.com/zhayt/user-service/certs/certstest"
+	"github.com/zhayt/user-service/config"
+	pb "github.com/zhayt/user-service/proto"
+	"github.com/zhayt/user-service/service/servicetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// tlsServers runs the gRPC port and the API listeners as run() wires them
+// with mutual TLS configured, each on its own loopback port.
+type tlsServers struct {
+	files    *certstest.Files
+	grpcAddr string
+	// httpAddrs maps the configured port of each API server to the
+	// address it listens on
+	httpAddrs map[string]string
+}
+
+func startTLSServers(t *testing.T) *tlsServers {
+	t.Helper()
+
+	files := certstest.Write(t)
+	f := servicetest.New(t, func(cfg *config.Config) {
+		cfg.GatewayPort = "gateway"
+		cfg.WebPort = "web"
+		cfg.GraphQLPort = "graphql"
+		cfg.TLSCertFile = files.CertFile
+		cfg.TLSKeyFile = files.KeyFile
+		cfg.TLSClientCAFile = files.ClientCAFile
+		cfg.TLSReloadInterval = time.Minute
+		cfg.CORSAllowedOrigins = []string{"http://localhost:3000"}
+	})
+	cfg, l := f.Config, f.Logger
+
+	reloader, err := certs.NewReloader(cfg, l)
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+
+	grpcServer, inprocessServer := newGRPCServers(cfg, f.Authenticator, reloader, l)
+	registerServices(f.Users, grpcServer, inprocessServer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	apiServers, closeAPI, err := newAPIServers(ctx, grpcServer, inprocessServer, f.Users, f.Authenticator, reloader, cfg, l)
+	if err != nil {
+		t.Fatalf("newAPIServers: %v", err)
+	}
+	t.Cleanup(closeAPI)
+	t.Cleanup(inprocessServer.Stop)
+
+	s := &tlsServers{files: files, httpAddrs: make(map[string]string)}
+
+	for _, srv := range apiServers {
+		lis := listen(t)
+		s.httpAddrs[strings.TrimPrefix(srv.Addr, ":")] = lis.Addr().String()
+
+		srv := srv
+		go func() { _ = srv.ServeTLS(lis, "", "") }()
+		t.Cleanup(func() { srv.Close() })
+	}
+
+	lis := listen(t)
+	s.grpcAddr = lis.Addr().String()
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	return s
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	return lis
+}
+
+// post sends body to url with the client certificate commonName presents,
+// or without a certificate when it is empty.
+func (s *tlsServers) post(t *testing.T, commonName, url, body string, header http.Header) (*http.Response, error) {
+	t.Helper()
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   s.files.ClientConfig(t, commonName),
+			ForceAttemptHTTP2: true,
+		},
+	}
+	t.Cleanup(client.CloseIdleConnections)
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+func TestAPIServersWithTLS(t *testing.T) {
+	s := startTLSServers(t)
+
+	connect := http.Header{"Connect-Protocol-Version": {"1"}}
+	tests := []struct {
+		name   string
+		server string
+		path   string
+		body   string
+		header http.Header
+	}{
+		{
+			name:   "gateway",
+			server: "gateway",
+			path:   "/v1/users",
+			body:   `{"name":"dave","email":"dave@example.com","password":"secret"}`,
+		},
+		{
+			name:   "connect",
+			server: "web",
+			path:   "/micro_forum_proto.UserService/CreateUser",
+			body:   `{"name":"erin","email":"erin@example.com","password":"secret"}`,
+			header: connect,
+		},
+		{
+			name:   "graphql",
+			server: "graphql",
+			path:   "/graphql",
+			body:   `{"query":"{ user(id: \"1\") { id } }"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := s.httpAddrs[tt.server]
+
+			resp, err := s.post(t, "forum-gateway", "https://"+addr+tt.path, tt.body, tt.header)
+			if err != nil {
+				t.Fatalf("with client certificate: %v", err)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("with client certificate: status %d, want 200", resp.StatusCode)
+			}
+
+			if resp.ProtoMajor != 2 {
+				t.Errorf("negotiated %s, want HTTP/2", resp.Proto)
+			}
+
+			if _, err := s.post(t, "", "https://"+addr+tt.path, tt.body, tt.header); err == nil {
+				t.Error("request without a client certificate succeeded")
+			}
+
+			// plaintext is not served next to TLS
+			resp, err = http.Post("http://"+addr+tt.path, "application/json", strings.NewReader(tt.body))
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					t.Error("plaintext request succeeded")
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCWithTLS(t *testing.T) {
+	s := startTLSServers(t)
+
+	dial := func(creds credentials.TransportCredentials) *grpc.ClientConn {
+		conn, err := grpc.Dial(s.grpcAddr, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn := dial(credentials.NewTLS(s.files.ClientConfig(t, "forum-gateway")))
+	if _, err := pb.NewUserServiceClient(conn).CreateUser(ctx, &pb.User{
+		Name:     "frank",
+		Email:    "frank@example.com",
+		Password: "secret",
+	}); err != nil {
+		t.Fatalf("CreateUser over TLS: %v", err)
+	}
+
+	conn = dial(insecure.NewCredentials())
+	if _, err := pb.NewUserServiceClient(conn).CreateUser(ctx, &pb.User{
+		Name:     "grace",
+		Email:    "grace@example.com",
+		Password: "secret",
+	}); err == nil {
+		t.Error("CreateUser over plaintext succeeded")
+	}
+}
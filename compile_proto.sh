@@ -1,14 +1,26 @@
 #!/bin/bash
 
-PROTO_FILES_PATH=/home/zhayt/google-dev/golang/micro-forum/micro-forum-proto
-OUTPUT_PATH=/home/zhayt/google-dev/golang/micro-forum/user-service
+PROTO_FILES_PATH=$(dirname "$0")/proto
+OUTPUT_PATH=$(dirname "$0")
 
 mkdir -p $OUTPUT_PATH/proto
 
-protoc \
-    --proto_path=$PROTO_FILES_PATH \
-    --go_out=$OUTPUT_PATH/proto \
-    --go_opt=paths=source_relative \
-    --go-grpc_out=$OUTPUT_PATH/proto \
-    --go-grpc_opt=paths=source_relative \
-    $PROTO_FILES_PATH/user.proto
\ No newline at end of file
+# compile_api <proto file relative to PROTO_FILES_PATH> <http rules yaml>
+compile_api() {
+    protoc \
+        --proto_path=$PROTO_FILES_PATH \
+        --go_out=$OUTPUT_PATH/proto \
+        --go_opt=paths=source_relative \
+        --go-grpc_out=$OUTPUT_PATH/proto \
+        --go-grpc_opt=paths=source_relative \
+        --grpc-gateway_out=$OUTPUT_PATH/proto \
+        --grpc-gateway_opt=paths=source_relative \
+        --grpc-gateway_opt=grpc_api_configuration=$2 \
+        --openapiv2_out=$OUTPUT_PATH/proto \
+        --openapiv2_opt=grpc_api_configuration=$2 \
+        --openapiv2_opt=openapi_naming_strategy=simple \
+        $PROTO_FILES_PATH/$1
+}
+
+compile_api user.proto $PROTO_FILES_PATH/user_api.yaml
+compile_api user/v2/user.proto $PROTO_FILES_PATH/user/v2/user_api.yaml
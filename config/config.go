@@ -1,21 +1,113 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"github.com/caarlos0/env/v8"
 	"github.com/joho/godotenv"
+	"io/fs"
 	"log"
+	"time"
 )
 
 type Config struct {
-	AppPort    string `env:"APP_PORT" envDefault:"5001"`
-	AppMode    string `env:"APP_MODE" envDefault:"dev"`
-	DBHost     string `env:"DB_HOST"`
-	DBPort     string `env:"DB_PORT"`
-	DBUser     string `env:"DB_USER"`
-	DBName     string `env:"DB_NAME"`
-	DBPassword string `env:"DB_PASSWORD"`
-	TZ         string `env:"TZ" envDefault:"Asia/Almaty"`
+	AppPort     string `env:"APP_PORT" envDefault:"5001"`
+	GatewayPort string `env:"GATEWAY_PORT" envDefault:"8080"`
+	WebPort     string `env:"WEB_PORT" envDefault:"8081"`
+	// MetricsPort serves /metrics, /healthz and /readyz
+	MetricsPort string `env:"METRICS_PORT" envDefault:"9090"`
+	// GraphQLPort enables the GraphQL endpoint when set
+	GraphQLPort string `env:"GRAPHQL_PORT"`
+	AppMode     string `env:"APP_MODE" envDefault:"dev"`
+	DBHost      string `env:"DB_HOST"`
+	DBPort      string `env:"DB_PORT"`
+	DBUser      string `env:"DB_USER"`
+	DBName      string `env:"DB_NAME"`
+	DBPassword  string `env:"DB_PASSWORD"`
+	TZ          string `env:"TZ" envDefault:"Asia/Almaty"`
+	// DBReplicaDSNs are read replicas of the postgres database, separated by
+	// ";". Lookups go to the healthy ones, falling back to the primary
+	DBReplicaDSNs []string `env:"DB_REPLICA_DSNS" envSeparator:";"`
+
+	// pool settings apply to the primary and to each replica
+	DBMaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" envDefault:"25"`
+	DBMaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" envDefault:"25"`
+	DBConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" envDefault:"30m"`
+	// DBQueryTimeout bounds every user storage query; 0 disables it
+	DBQueryTimeout time.Duration `env:"DB_QUERY_TIMEOUT" envDefault:"3s"`
+	// DBDialTimeout is how long startup retries an unreachable database,
+	// waiting DBDialBackoff after the first attempt and doubling each time
+	DBDialTimeout time.Duration `env:"DB_DIAL_TIMEOUT" envDefault:"1m"`
+	DBDialBackoff time.Duration `env:"DB_DIAL_BACKOFF" envDefault:"500ms"`
+
+	// StorageBackend is "postgres", "sqlite" or "memory". sqlite uses only
+	// the query, dial and connection lifetime DB_* settings, and a single
+	// connection
+	StorageBackend string `env:"STORAGE_BACKEND" envDefault:"postgres"`
+	// SQLiteDSN is the database file path or "file:" URI of the sqlite backend
+	SQLiteDSN string `env:"SQLITE_DSN" envDefault:"user-service.db"`
+	// MigrateOnStart applies pending migrations before serving; replicas
+	// starting together take turns on a lock
+	MigrateOnStart bool `env:"MIGRATE_ON_START" envDefault:"true"`
+
+	// CacheEnabled caches user lookups by id in process. Other instances
+	// may serve a changed user until CacheTTL passes
+	CacheEnabled     bool          `env:"CACHE_ENABLED" envDefault:"false"`
+	CacheSize        int           `env:"CACHE_SIZE" envDefault:"10000"`
+	CacheTTL         time.Duration `env:"CACHE_TTL" envDefault:"1m"`
+	CacheNegativeTTL time.Duration `env:"CACHE_NEGATIVE_TTL" envDefault:"5s"`
+
+	// ShutdownPropagationDelay is how long the servers keep serving after
+	// readiness drops, so load balancers stop routing here before
+	// ShutdownTimeout starts draining the in-flight calls
+	ShutdownPropagationDelay time.Duration `env:"SHUTDOWN_PROPAGATION_DELAY" envDefault:"5s"`
+	ShutdownTimeout          time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"15s"`
+
+	// TLSCertFile and TLSKeyFile enable TLS on AppPort; TLSClientCAFile
+	// additionally requires client certificates signed by that CA
+	TLSCertFile       string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `env:"TLS_KEY_FILE"`
+	TLSClientCAFile   string        `env:"TLS_CLIENT_CA_FILE"`
+	TLSReloadInterval time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"30s"`
+	// TLSAdminIdentities lists the client certificate CNs/SANs allowed to
+	// call admin RPCs
+	TLSAdminIdentities []string `env:"TLS_ADMIN_IDENTITIES" envSeparator:","`
+
+	// AuthJWTSecret verifies HS256 user tokens and is required; AuthServiceKeys
+	// and AuthAdminKeys map caller names to API keys ("name:key,name:key").
+	// None of them belong in .env: pass them from the environment
+	AuthJWTSecret   string            `env:"AUTH_JWT_SECRET"`
+	AuthJWTIssuer   string            `env:"AUTH_JWT_ISSUER"`
+	AuthServiceKeys map[string]string `env:"AUTH_SERVICE_KEYS" envKeyValSeparator:":"`
+	AuthAdminKeys   map[string]string `env:"AUTH_ADMIN_KEYS" envKeyValSeparator:":"`
+
+	// LegacyEmailMutations keeps the deprecated email-keyed UpdateUserPassword
+	// and UpdateUserName RPCs enabled for clients not yet moved to the
+	// id-keyed ones; they are off by default
+	LegacyEmailMutations bool `env:"LEGACY_EMAIL_MUTATIONS" envDefault:"false"`
+
+	CORSAllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS" envSeparator:"," envDefault:"http://localhost:3000"`
+	CORSAllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" envDefault:"false"`
+	CORSMaxAge           time.Duration `env:"CORS_MAX_AGE" envDefault:"10m"`
+
+	// HTTPReadHeaderTimeout and HTTPIdleTimeout apply to every HTTP listener
+	HTTPReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" envDefault:"10s"`
+	HTTPIdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT" envDefault:"2m"`
+
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"5s"`
+	HealthCheckTimeout  time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s"`
+
+	TracingExporter     string  `env:"TRACING_EXPORTER" envDefault:"none"`
+	TracingFile         string  `env:"TRACING_FILE" envDefault:"traces.json"`
+	TracingOTLPEndpoint string  `env:"TRACING_OTLP_ENDPOINT" envDefault:"localhost:4317"`
+	TracingOTLPInsecure bool    `env:"TRACING_OTLP_INSECURE" envDefault:"true"`
+	TracingSampleRatio  float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
+
+	WebhookWorkers     int           `env:"WEBHOOK_WORKERS" envDefault:"4"`
+	WebhookQueueSize   int           `env:"WEBHOOK_QUEUE_SIZE" envDefault:"1024"`
+	WebhookMaxAttempts int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"5"`
+	WebhookBackoff     time.Duration `env:"WEBHOOK_BACKOFF" envDefault:"1s"`
+	WebhookTimeout     time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"5s"`
 }
 
 func NewConfig() (*Config, error) {
@@ -28,10 +120,12 @@ func NewConfig() (*Config, error) {
 	return &cfg, nil
 }
 
+// PrepareENV loads .env when there is one; containers get their settings
+// from the environment instead.
 func PrepareENV() {
 	err := godotenv.Load(".env")
 
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Fatal(err)
 	}
 }
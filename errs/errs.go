@@ -0,0 +1,88 @@
+// Package errs defines the domain errors returned by storage and service
+// code, and their translation into gRPC statuses.
+package errs
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/runtime/protoiface"
+)
+
+// Error kinds. Match them with errors.Is; each maps to one gRPC code.
+var (
+	ErrInvalidArgument    = errors.New("invalid argument")
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrVersionConflict    = errors.New("version conflict")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrUnimplemented      = errors.New("unimplemented")
+)
+
+// Reasons reported in google.rpc.ErrorInfo. They are part of the API, so
+// clients may switch on them; never change an existing one.
+const (
+	ReasonInvalidArgument    = "INVALID_ARGUMENT"
+	ReasonValidationFailed   = "VALIDATION_FAILED"
+	ReasonUserNotFound       = "USER_NOT_FOUND"
+	ReasonWebhookNotFound    = "WEBHOOK_NOT_FOUND"
+	ReasonUserExists         = "USER_ALREADY_EXISTS"
+	ReasonVersionConflict    = "USER_VERSION_CONFLICT"
+	ReasonInvalidPassword    = "INVALID_PASSWORD"
+	ReasonNotOwner           = "NOT_ACCOUNT_OWNER"
+	ReasonDeprecatedEndpoint = "DEPRECATED_ENDPOINT"
+)
+
+// Error is a domain error. Message, Reason, Metadata and Details are sent
+// to clients; Cause is only for logs.
+type Error struct {
+	Kind     error
+	Reason   string
+	Message  string
+	Metadata map[string]string
+	// Details are extra status details, such as the current state of a
+	// resource on a version conflict.
+	Details []protoiface.MessageV1
+	Cause   error
+}
+
+func New(kind error, reason, message string) *Error {
+	return &Error{Kind: kind, Reason: reason, Message: message}
+}
+
+func (e *Error) WithCause(cause error) *Error {
+	e.Cause = cause
+	return e
+}
+
+func (e *Error) WithMetadata(key, value string) *Error {
+	if e.Metadata == nil {
+		e.Metadata = make(map[string]string)
+	}
+
+	e.Metadata[key] = value
+	return e
+}
+
+func (e *Error) WithDetails(details ...protoiface.MessageV1) *Error {
+	e.Details = append(e.Details, details...)
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches the error kind, so errors.Is(err, ErrNotFound) works through
+// any wrapping.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
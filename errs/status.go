@@ -0,0 +1,64 @@
+package errs
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain is the google.rpc.ErrorInfo domain of this service.
+const Domain = "user-service.micro-forum"
+
+var codesByKind = map[error]codes.Code{
+	ErrInvalidArgument:    codes.InvalidArgument,
+	ErrNotFound:           codes.NotFound,
+	ErrConflict:           codes.AlreadyExists,
+	ErrVersionConflict:    codes.Aborted,
+	ErrInvalidCredentials: codes.InvalidArgument,
+	ErrPermissionDenied:   codes.PermissionDenied,
+	ErrUnimplemented:      codes.Unimplemented,
+}
+
+// Status translates err into the status sent to clients. Statuses pass
+// through unchanged and domain errors keep their message and gain an
+// ErrorInfo. Anything else is an opaque INTERNAL, so causes never leak.
+func Status(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err)
+	}
+
+	var domainErr *Error
+	if !errors.As(err, &domainErr) {
+		return status.New(codes.Internal, "internal error")
+	}
+
+	code, ok := codesByKind[domainErr.Kind]
+	if !ok {
+		return status.New(codes.Internal, "internal error")
+	}
+
+	st := status.New(code, domainErr.Message)
+	withDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   domainErr.Reason,
+		Domain:   Domain,
+		Metadata: domainErr.Metadata,
+	})
+	if detailsErr != nil {
+		return st
+	}
+
+	if len(domainErr.Details) > 0 {
+		if all, err := withDetails.WithDetails(domainErr.Details...); err == nil {
+			withDetails = all
+		}
+	}
+
+	return withDetails
+}
@@ -0,0 +1,23 @@
+package errs
+
+// Errors shared by the storage backends, so they report the same kinds,
+// reasons and messages.
+
+func UserNotFound() *Error {
+	return New(ErrNotFound, ReasonUserNotFound, "user not found")
+}
+
+func WebhookNotFound() *Error {
+	return New(ErrNotFound, ReasonWebhookNotFound, "webhook not found")
+}
+
+// UserExists reports a duplicate email or name; field is sent to clients
+// in the ErrorInfo metadata.
+func UserExists(field string) *Error {
+	return New(ErrConflict, ReasonUserExists, "user with this "+field+" already exists").
+		WithMetadata("field", field)
+}
+
+func UserVersionConflict() *Error {
+	return New(ErrVersionConflict, ReasonVersionConflict, "user was modified concurrently")
+}
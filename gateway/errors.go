@@ -0,0 +1,25 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/status"
+)
+
+// errorHandler writes gRPC errors as JSON google.rpc.Status bodies. The HTTP
+// status comes from runtime.HTTPStatusFromCode, which follows the mapping in
+// google/rpc/code.proto (NotFound -> 404, AlreadyExists -> 409,
+// Unauthenticated -> 401 and so on).
+func errorHandler(l *zap.Logger) runtime.ErrorHandlerFunc {
+	return func(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+		st := status.Convert(err)
+		if runtime.HTTPStatusFromCode(st.Code()) >= http.StatusInternalServerError {
+			l.Error("gateway request failed", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+		}
+
+		runtime.DefaultHTTPErrorHandler(ctx, mux, m, w, r, err)
+	}
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/interceptor"
+	pb "github.com/zhayt/user-service/proto"
+	userv2 "github.com/zhayt/user-service/proto/user/v2"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Dial connects to the gRPC server through the in-process listener lis.
+// The gateway uses it instead of the public port, which may require
+// client certificates the gateway does not have.
+func Dial(ctx context.Context, lis *bufconn.Listener) (*grpc.ClientConn, error) {
+	conn, err := grpc.DialContext(ctx, "inprocess",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// continue the caller's trace across the hop to the gRPC server
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial in-process grpc server: %w", err)
+	}
+
+	return conn, nil
+}
+
+// NewServer builds the HTTP/JSON gateway. It proxies every call over conn to
+// the gRPC server, so requests go through the same interceptors and handlers
+// as native gRPC clients.
+func NewServer(ctx context.Context, conn *grpc.ClientConn, cfg *config.Config, l *zap.Logger) (*http.Server, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+		runtime.WithErrorHandler(errorHandler(l)),
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+	)
+
+	if err := pb.RegisterUserServiceHandler(ctx, mux, conn); err != nil {
+		return nil, fmt.Errorf("cannot register gateway handler: %w", err)
+	}
+
+	if err := userv2.RegisterUserServiceHandler(ctx, mux, conn); err != nil {
+		return nil, fmt.Errorf("cannot register v2 gateway handler: %w", err)
+	}
+
+	router := http.NewServeMux()
+	router.Handle("/", mux)
+	router.HandleFunc("/openapi.json", serveOpenAPI(pb.OpenAPI))
+	router.HandleFunc("/v2/openapi.json", serveOpenAPI(userv2.OpenAPI))
+
+	return &http.Server{
+		Addr:              net.JoinHostPort("", cfg.GatewayPort),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}, nil
+}
+
+// headerMatcher forwards the request id, API key and Accept-Language as-is
+// on top of the default grpcgateway- prefixed headers.
+func headerMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, interceptor.RequestIDHeader) {
+		return interceptor.RequestIDHeader, true
+	}
+
+	if strings.EqualFold(key, interceptor.APIKeyHeader) {
+		return interceptor.APIKeyHeader, true
+	}
+
+	if strings.EqualFold(key, interceptor.ReadYourWritesHeader) {
+		return interceptor.ReadYourWritesHeader, true
+	}
+
+	// validation messages are localised from it
+	if strings.EqualFold(key, "Accept-Language") {
+		return "accept-language", true
+	}
+
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+func serveOpenAPI(doc []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(doc)
+	}
+}
@@ -0,0 +1,231 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/gateway"
+	"github.com/zhayt/user-service/service/servicetest"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGateway serves the gateway over HTTP in front of an in-process gRPC
+// server with the production interceptor chain and in-memory storage.
+func newGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	f := servicetest.New(t, func(cfg *config.Config) {
+		cfg.LegacyEmailMutations = true
+	})
+
+	grpcServer := f.GRPCServer()
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	conn, err := gateway.Dial(ctx, lis)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	srv, err := gateway.NewServer(ctx, conn, f.Config, f.Logger)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	ts := httptest.NewServer(srv.Handler)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+type call struct {
+	method string
+	path   string
+	body   interface{}
+	// header is added to the request, e.g. credentials
+	header http.Header
+}
+
+// do sends c and decodes the JSON response body into a map.
+func do(t *testing.T, ts *httptest.Server, c call) (int, map[string]interface{}) {
+	t.Helper()
+
+	var body bytes.Buffer
+	if c.body != nil {
+		if err := json.NewEncoder(&body).Encode(c.body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+
+	req, err := http.NewRequest(c.method, ts.URL+c.path, &body)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", c.method, c.path, err)
+	}
+	defer resp.Body.Close()
+
+	var out map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("%s %s: decode response: %v", c.method, c.path, err)
+	}
+
+	return resp.StatusCode, out
+}
+
+func serviceKey() http.Header {
+	return http.Header{"X-Api-Key": {servicetest.ServiceKey}}
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestGatewayUserLifecycle(t *testing.T) {
+	ts := newGateway(t)
+
+	code, created := do(t, ts, call{method: http.MethodPost, path: "/v1/users", body: map[string]string{
+		"name":     "alice",
+		"email":    "alice@example.com",
+		"password": "secret",
+	}})
+	if code != http.StatusOK {
+		t.Fatalf("create: status %d, body %v", code, created)
+	}
+
+	// protojson renders uint64 as a string
+	id, err := strconv.ParseUint(created["id"].(string), 10, 64)
+	if err != nil || id == 0 {
+		t.Fatalf("create: invalid id %v", created["id"])
+	}
+
+	path := "/v1/users/" + strconv.FormatUint(id, 10)
+
+	code, user := do(t, ts, call{method: http.MethodGet, path: path, header: serviceKey()})
+	if code != http.StatusOK {
+		t.Fatalf("get: status %d, body %v", code, user)
+	}
+
+	if user["name"] != "alice" || user["email"] != "alice@example.com" {
+		t.Errorf("get: unexpected user %v", user)
+	}
+
+	code, updated := do(t, ts, call{
+		method: http.MethodPut,
+		path:   path + "/name",
+		body:   map[string]interface{}{"new_name": "alicia", "expected_version": user["version"]},
+		header: bearer(servicetest.UserToken(t, id, "")),
+	})
+	if code != http.StatusOK || updated["success"] != true {
+		t.Fatalf("update: status %d, body %v", code, updated)
+	}
+
+	code, user = do(t, ts, call{method: http.MethodGet, path: path, header: serviceKey()})
+	if code != http.StatusOK || user["name"] != "alicia" || user["version"] != updated["version"] {
+		t.Errorf("get after update: status %d, user %v, want name alicia and version %v", code, user, updated["version"])
+	}
+}
+
+func TestGatewayErrorMapping(t *testing.T) {
+	ts := newGateway(t)
+
+	code, created := do(t, ts, call{method: http.MethodPost, path: "/v1/users", body: map[string]string{
+		"name":     "bob",
+		"email":    "bob@example.com",
+		"password": "secret",
+	}})
+	if code != http.StatusOK {
+		t.Fatalf("create: status %d, body %v", code, created)
+	}
+	id, _ := strconv.ParseUint(created["id"].(string), 10, 64)
+	path := "/v1/users/" + strconv.FormatUint(id, 10)
+
+	tests := []struct {
+		name string
+		call call
+		code int
+	}{
+		{
+			name: "invalid argument",
+			call: call{method: http.MethodPost, path: "/v1/users", body: map[string]string{"name": "b0b!", "email": "x", "password": ""}},
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "already exists",
+			call: call{method: http.MethodPost, path: "/v1/users", body: map[string]string{
+				"name":     "Bob",
+				"email":    "bobby@example.com",
+				"password": "secret",
+			}},
+			code: http.StatusConflict,
+		},
+		{
+			name: "not found",
+			call: call{method: http.MethodGet, path: "/v1/users/999", header: serviceKey()},
+			code: http.StatusNotFound,
+		},
+		{
+			name: "missing credentials",
+			call: call{method: http.MethodGet, path: path},
+			code: http.StatusUnauthorized,
+		},
+		{
+			name: "invalid credentials",
+			call: call{method: http.MethodGet, path: path, header: http.Header{"X-Api-Key": {"wrong"}}},
+			code: http.StatusUnauthorized,
+		},
+		{
+			name: "other user",
+			call: call{
+				method: http.MethodPut,
+				path:   path + "/name",
+				body:   map[string]string{"new_name": "mallory"},
+				header: bearer(servicetest.UserToken(t, id+1, "")),
+			},
+			code: http.StatusForbidden,
+		},
+		{
+			name: "stale version",
+			call: call{
+				method: http.MethodPut,
+				path:   path + "/name",
+				body:   map[string]interface{}{"new_name": "robert", "expected_version": "99"},
+				header: serviceKey(),
+			},
+			code: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := do(t, ts, tt.call)
+			if code != tt.code {
+				t.Fatalf("status %d, want %d, body %v", code, tt.code, body)
+			}
+
+			// errors are google.rpc.Status bodies
+			if _, ok := body["code"]; !ok {
+				t.Errorf("error body %v has no code", body)
+			}
+		})
+	}
+}
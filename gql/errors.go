@@ -0,0 +1,26 @@
+package gql
+
+import (
+	"github.com/zhayt/user-service/errs"
+	"google.golang.org/grpc/status"
+)
+
+// statusError shows the client-safe part of a service error in GraphQL
+// responses, with the gRPC code as an extension.
+type statusError struct {
+	st *status.Status
+}
+
+// publicError translates err the same way the gRPC API does, so internal
+// causes never reach GraphQL clients either.
+func publicError(err error) error {
+	return &statusError{st: errs.Status(err)}
+}
+
+func (e *statusError) Error() string {
+	return e.st.Message()
+}
+
+func (e *statusError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.st.Code().String()}
+}
@@ -0,0 +1,84 @@
+package gql
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const _batchWait = 2 * time.Millisecond
+
+type (
+	loaderKey struct{}
+	budgetKey struct{}
+)
+
+// newUserLoader batches user lookups made while resolving one request into
+// a single UserService.GetUsersByIDs call.
+func newUserLoader(users *service.UserService) *dataloader.Loader[uint64, *model.User] {
+	batch := func(ctx context.Context, ids []uint64) []*dataloader.Result[*model.User] {
+		found, err := users.GetUsersByIDs(ctx, ids)
+
+		results := make([]*dataloader.Result[*model.User], len(ids))
+		if err != nil {
+			for i := range results {
+				results[i] = &dataloader.Result[*model.User]{Error: publicError(err)}
+			}
+			return results
+		}
+
+		byID := make(map[uint64]*model.User, len(found))
+		for _, user := range found {
+			byID[user.ID] = user
+		}
+
+		// a missing user resolves to null rather than an error
+		for i, id := range ids {
+			results[i] = &dataloader.Result[*model.User]{Data: byID[id]}
+		}
+
+		return results
+	}
+
+	return dataloader.NewBatchedLoader(batch,
+		dataloader.WithWait[uint64, *model.User](_batchWait),
+		dataloader.WithBatchCapacity[uint64, *model.User](_maxUserIDs),
+		dataloader.WithCache[uint64, *model.User](&dataloader.NoCache[uint64, *model.User]{}),
+	)
+}
+
+func withUserLoader(ctx context.Context, loader *dataloader.Loader[uint64, *model.User]) context.Context {
+	return context.WithValue(ctx, loaderKey{}, loader)
+}
+
+func userLoader(ctx context.Context) *dataloader.Loader[uint64, *model.User] {
+	return ctx.Value(loaderKey{}).(*dataloader.Loader[uint64, *model.User])
+}
+
+// idBudget bounds the user ids one request looks up across all its user and
+// users fields, so aliasing them does not get around _maxUserIDs.
+type idBudget struct {
+	remaining atomic.Int64
+}
+
+func withIDBudget(ctx context.Context) context.Context {
+	b := &idBudget{}
+	b.remaining.Store(_maxUserIDs)
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// reserveIDs takes n ids from the budget of the request.
+func reserveIDs(ctx context.Context, n int) error {
+	b := ctx.Value(budgetKey{}).(*idBudget)
+	if b.remaining.Add(-int64(n)) < 0 {
+		return publicError(status.Errorf(codes.InvalidArgument, "at most %d users may be requested per query", _maxUserIDs))
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+	pb "github.com/zhayt/user-service/proto"
+	"github.com/zhayt/user-service/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// _maxUserIDs bounds the users one query may look up by id, and so each
+// batched lookup.
+const _maxUserIDs = 100
+
+type Resolver struct {
+	users *service.UserService
+}
+
+func (r *Resolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := reserveIDs(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	user, err := userLoader(ctx).Load(ctx, id)()
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	return newUserResolver(ctx, user), nil
+}
+
+func (r *Resolver) Users(ctx context.Context, args struct{ IDs []graphql.ID }) ([]*userResolver, error) {
+	if err := reserveIDs(ctx, len(args.IDs)); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, 0, len(args.IDs))
+	for _, raw := range args.IDs {
+		id, err := parseID(raw)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	users, errs := userLoader(ctx).LoadMany(ctx, ids)()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resolvers := make([]*userResolver, len(users))
+	for i, user := range users {
+		if user != nil {
+			resolvers[i] = newUserResolver(ctx, user)
+		}
+	}
+
+	return resolvers, nil
+}
+
+func (r *Resolver) UserByEmail(ctx context.Context, args struct{ Email string }) (*userResolver, error) {
+	if !isAdmin(ctx) {
+		return nil, status.Errorf(codes.PermissionDenied, "userByEmail requires admin access")
+	}
+
+	userPB, err := r.users.GetUserByEmail(ctx, &pb.GetUserByEmailReq{Email: args.Email})
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, publicError(err)
+	}
+
+	user := &model.User{
+		ID:        userPB.Id,
+		Name:      userPB.Name,
+		Email:     userPB.Email,
+		CreatedAt: userPB.CreatedAt.AsTime(),
+		UpdatedAt: userPB.UpdatedAt.AsTime(),
+	}
+	if userPB.LastLoginAt != nil {
+		lastLogin := userPB.LastLoginAt.AsTime()
+		user.LastLoginAt = &lastLogin
+	}
+
+	return newUserResolver(ctx, user), nil
+}
+
+func (r *Resolver) SearchUsers(ctx context.Context, args struct {
+	Query           string
+	CreatedAfter    *graphql.Time
+	CreatedBefore   *graphql.Time
+	LastLoginAfter  *graphql.Time
+	LastLoginBefore *graphql.Time
+	Limit           int32
+	Offset          int32
+}) ([]*userResolver, error) {
+	// listing every user is not for anonymous callers
+	if strings.TrimSpace(args.Query) == "" && auth.FromContext(ctx) == nil {
+		return nil, publicError(status.Errorf(codes.Unauthenticated, "searchUsers without a query requires authentication"))
+	}
+
+	// lastLoginAt is admin-only, so filtering on it is too
+	if (args.LastLoginAfter != nil || args.LastLoginBefore != nil) && !isAdmin(ctx) {
+		return nil, publicError(status.Errorf(codes.PermissionDenied, "lastLoginAfter and lastLoginBefore require admin access"))
+	}
+
+	users, err := r.users.SearchUsers(ctx, &model.UserFilter{
+		Query:           args.Query,
+		CreatedAfter:    timeArg(args.CreatedAfter),
+		CreatedBefore:   timeArg(args.CreatedBefore),
+		LastLoginAfter:  timeArg(args.LastLoginAfter),
+		LastLoginBefore: timeArg(args.LastLoginBefore),
+		Limit:           int(args.Limit),
+		Offset:          int(args.Offset),
+	})
+	if err != nil {
+		return nil, publicError(err)
+	}
+
+	resolvers := make([]*userResolver, 0, len(users))
+	for _, user := range users {
+		resolvers = append(resolvers, newUserResolver(ctx, user))
+	}
+
+	return resolvers, nil
+}
+
+type userResolver struct {
+	user  *model.User
+	admin bool
+}
+
+func newUserResolver(ctx context.Context, user *model.User) *userResolver {
+	return &userResolver{user: user, admin: isAdmin(ctx)}
+}
+
+func (r *userResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatUint(r.user.ID, 10))
+}
+
+func (r *userResolver) Name() string {
+	return r.user.Name
+}
+
+func (r *userResolver) Email() *string {
+	if !r.admin {
+		return nil
+	}
+
+	return &r.user.Email
+}
+
+func (r *userResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.user.CreatedAt}
+}
+
+func (r *userResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: r.user.UpdatedAt}
+}
+
+func (r *userResolver) LastLoginAt() *graphql.Time {
+	if !r.admin || r.user.LastLoginAt == nil {
+		return nil
+	}
+
+	return &graphql.Time{Time: *r.user.LastLoginAt}
+}
+
+func timeArg(t *graphql.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	return &t.Time
+}
+
+func parseID(id graphql.ID) (uint64, error) {
+	parsed, err := strconv.ParseUint(string(id), 10, 64)
+	if err != nil || parsed == 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid user id %q", id)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,63 @@
+package gql
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/interceptor"
+	"github.com/zhayt/user-service/service"
+	"go.uber.org/zap"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// _method names GraphQL requests in access logs and metrics.
+const _method = "/graphql"
+
+// NewServer exposes a read-only GraphQL API over users on cfg.GraphQLPort.
+// Each request gets its own loader, so lookups are batched per request and
+// nothing is cached between requests. Requests get the request id, metrics,
+// access log and panic recovery of the gRPC API.
+func NewServer(users *service.UserService, authenticator *auth.Authenticator, cfg *config.Config, l *zap.Logger) *http.Server {
+	s := graphql.MustParseSchema(schema, &Resolver{users: users})
+
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", interceptor.HTTP(_method, l, withRequestScope(users, authenticator, &relay.Handler{Schema: s})))
+
+	return &http.Server{
+		Addr:              net.JoinHostPort("", cfg.GraphQLPort),
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
+}
+
+func withRequestScope(users *service.UserService, authenticator *auth.Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := withIDBudget(withUserLoader(r.Context(), newUserLoader(users)))
+
+		// anonymous callers may read public fields; bad credentials are rejected
+		identity, err := authenticator.Authenticate(r.Header.Get("Authorization"), r.Header.Get("X-Api-Key"))
+		switch {
+		case err == nil:
+			ctx = auth.WithIdentity(ctx, identity)
+		case !errors.Is(err, auth.ErrNoCredentials):
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func isAdmin(ctx context.Context) bool {
+	return auth.FromContext(ctx).IsAdmin()
+}
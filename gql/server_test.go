@@ -0,0 +1,289 @@
+package gql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/gql"
+	"github.com/zhayt/user-service/model"
+	pb "github.com/zhayt/user-service/proto"
+	"github.com/zhayt/user-service/service/servicetest"
+	"github.com/zhayt/user-service/storage"
+	"go.uber.org/zap"
+)
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// newGraphQL serves the GraphQL API over in-memory storage holding users
+// named userx, userxx and so on, n of them.
+func newGraphQL(t *testing.T, n int) *httptest.Server {
+	t.Helper()
+
+	f := servicetest.New(t, func(cfg *config.Config) {
+		cfg.WebhookQueueSize = n + 1
+	})
+
+	for i := 1; i <= n; i++ {
+		if _, err := f.Users.CreateUser(context.Background(), &pb.User{
+			Name:     "user" + strings.Repeat("x", i),
+			Email:    fmt.Sprintf("user%d@example.com", i),
+			Password: "secret",
+		}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	ts := httptest.NewServer(gql.NewServer(f.Users, f.Authenticator, f.Config, f.Logger).Handler)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func query(t *testing.T, ts *httptest.Server, apiKey, q string) response {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"query": q})
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/graphql", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-Api-Key", apiKey)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	return out
+}
+
+func errorCode(resp response) string {
+	if len(resp.Errors) == 0 {
+		return ""
+	}
+
+	code, _ := resp.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+func TestUsersCapsIDs(t *testing.T) {
+	ts := newGraphQL(t, 2)
+
+	resp := query(t, ts, "", `{ users(ids: ["1", "2", "3"]) { id name } }`)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("users: %v", resp.Errors)
+	}
+
+	var users []*struct{ ID string }
+	if err := json.Unmarshal(resp.Data["users"], &users); err != nil {
+		t.Fatalf("decode users: %v", err)
+	}
+
+	if len(users) != 3 || users[0].ID != "1" || users[1].ID != "2" || users[2] != nil {
+		t.Errorf("users = %s, want users 1, 2 and null", resp.Data["users"])
+	}
+
+	ids := make([]string, 101)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%q", fmt.Sprint(i+1))
+	}
+
+	resp = query(t, ts, "", `{ users(ids: [`+strings.Join(ids, ",")+`]) { id } }`)
+	if errorCode(resp) != "InvalidArgument" {
+		t.Errorf("101 ids: errors %v, want InvalidArgument", resp.Errors)
+	}
+}
+
+func TestSearchUsersWithoutQueryRequiresAuthentication(t *testing.T) {
+	ts := newGraphQL(t, 3)
+
+	tests := []struct {
+		name   string
+		apiKey string
+		query  string
+		code   string
+		found  int
+	}{
+		{name: "anonymous with query", query: "userxx", found: 2},
+		{name: "anonymous without query", query: "", code: "Unauthenticated"},
+		{name: "anonymous with blank query", query: "  ", code: "Unauthenticated"},
+		{name: "service without query", apiKey: servicetest.ServiceKey, query: "", found: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := query(t, ts, tt.apiKey, fmt.Sprintf(`{ searchUsers(query: %q) { id } }`, tt.query))
+			if errorCode(resp) != tt.code {
+				t.Fatalf("errors %v, want code %q", resp.Errors, tt.code)
+			}
+
+			if tt.code != "" {
+				return
+			}
+
+			var users []struct{ ID string }
+			if err := json.Unmarshal(resp.Data["searchUsers"], &users); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			if len(users) != tt.found {
+				t.Errorf("found %d users, want %d", len(users), tt.found)
+			}
+		})
+	}
+}
+
+func TestSearchUsersLastLoginFiltersRequireAdmin(t *testing.T) {
+	ts := newGraphQL(t, 2)
+
+	tests := []struct {
+		name   string
+		apiKey string
+		filter string
+		code   string
+	}{
+		{name: "anonymous after", filter: `lastLoginAfter: "2020-01-01T00:00:00Z"`, code: "PermissionDenied"},
+		{name: "service before", apiKey: servicetest.ServiceKey, filter: `lastLoginBefore: "2020-01-01T00:00:00Z"`, code: "PermissionDenied"},
+		{name: "anonymous created", filter: `createdAfter: "2020-01-01T00:00:00Z"`},
+		{name: "admin before", apiKey: servicetest.AdminKey, filter: `lastLoginBefore: "2999-01-01T00:00:00Z"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := query(t, ts, tt.apiKey, `{ searchUsers(query: "user", `+tt.filter+`) { id } }`)
+			if errorCode(resp) != tt.code {
+				t.Fatalf("errors %v, want code %q", resp.Errors, tt.code)
+			}
+		})
+	}
+}
+
+func TestUsersCapsIDsAcrossAliases(t *testing.T) {
+	ts := newGraphQL(t, 1)
+
+	ids := make([]string, 60)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%q", fmt.Sprint(i+1))
+	}
+	list := strings.Join(ids, ",")
+
+	resp := query(t, ts, "", `{ a: users(ids: [`+list+`]) { id } b: users(ids: [`+list+`]) { id } }`)
+	if errorCode(resp) != "InvalidArgument" {
+		t.Errorf("120 ids over two aliases: errors %v, want InvalidArgument", resp.Errors)
+	}
+
+	fields := make([]string, 101)
+	for i := range fields {
+		fields[i] = fmt.Sprintf(`u%d: user(id: "1") { id }`, i)
+	}
+
+	resp = query(t, ts, "", `{ `+strings.Join(fields, " ")+` }`)
+	if errorCode(resp) != "InvalidArgument" {
+		t.Errorf("101 user fields: errors %v, want InvalidArgument", resp.Errors)
+	}
+}
+
+// countingUsers counts the GetUsersByIDs calls reaching storage.
+type countingUsers struct {
+	storage.IStorage
+	calls atomic.Int32
+}
+
+func (c *countingUsers) GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error) {
+	c.calls.Add(1)
+	return c.IStorage.GetUsersByIDs(ctx, ids)
+}
+
+func TestUserFieldsAreBatched(t *testing.T) {
+	repo := storage.NewMemoryStorage(zap.NewNop())
+	users := &countingUsers{IStorage: repo.IStorage}
+
+	f := servicetest.NewWithStorage(t, &storage.Storage{IStorage: users, IWebhookStorage: repo.IWebhookStorage}, nil)
+	for i := 1; i <= 5; i++ {
+		if _, err := f.Users.CreateUser(context.Background(), &pb.User{
+			Name:     "user" + strings.Repeat("x", i),
+			Email:    fmt.Sprintf("user%d@example.com", i),
+			Password: "secret",
+		}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	ts := httptest.NewServer(gql.NewServer(f.Users, f.Authenticator, f.Config, f.Logger).Handler)
+	t.Cleanup(ts.Close)
+
+	resp := query(t, ts, "", `{
+		a: user(id: "1") { id }
+		b: user(id: "2") { id }
+		c: user(id: "3") { id }
+		d: user(id: "4") { id }
+		e: user(id: "5") { id }
+		f: user(id: "6") { id }
+	}`)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("errors: %v", resp.Errors)
+	}
+
+	if string(resp.Data["e"]) != `{"id":"5"}` || string(resp.Data["f"]) != "null" {
+		t.Errorf("data = %v", resp.Data)
+	}
+
+	if n := users.calls.Load(); n != 1 {
+		t.Errorf("GetUsersByIDs called %d times, want 1", n)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	ts := newGraphQL(t, 0)
+
+	post := func(requestID string) string {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/graphql", strings.NewReader(`{"query":"{ user(id: \"1\") { id } }"}`))
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if requestID != "" {
+			req.Header.Set("X-Request-Id", requestID)
+		}
+
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		resp.Body.Close()
+
+		return resp.Header.Get("X-Request-Id")
+	}
+
+	if got := post("gql-test-request"); got != "gql-test-request" {
+		t.Errorf("propagated request id = %q", got)
+	}
+
+	if got := post(""); len(got) != 32 {
+		t.Errorf("generated request id = %q, want 32 hex digits", got)
+	}
+}
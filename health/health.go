@@ -0,0 +1,136 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// LivenessService is the grpc.health.v1 service name reporting liveness.
+// Readiness is reported on "" and on every service passed to NewChecker.
+const LivenessService = "liveness"
+
+// Pinger is the storage dependency readiness is checked against; *sqlx.DB
+// implements it.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Checker pings the database in the background and flips readiness of the
+// served services to NOT_SERVING while it is unreachable. A nil Pinger, as
+// used by the in-memory backend, is always ready. Liveness
+// stays SERVING until Shutdown, since restarting the process does not fix
+// a database outage.
+type Checker struct {
+	server   *health.Server
+	db       Pinger
+	services []string
+	interval time.Duration
+	timeout  time.Duration
+	ready    atomic.Bool
+	alive    atomic.Bool
+	l        *zap.Logger
+}
+
+func NewChecker(db Pinger, cfg *config.Config, l *zap.Logger, services ...string) *Checker {
+	c := &Checker{
+		server:   health.NewServer(),
+		db:       db,
+		services: append([]string{""}, services...),
+		interval: cfg.HealthCheckInterval,
+		timeout:  cfg.HealthCheckTimeout,
+		l:        l,
+	}
+
+	c.alive.Store(true)
+	c.server.SetServingStatus(LivenessService, healthpb.HealthCheckResponse_SERVING)
+	c.setReady(false)
+
+	return c
+}
+
+// Register exposes grpc.health.v1.Health on s.
+func (c *Checker) Register(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, c.server)
+}
+
+// Run pings the database every interval until ctx is cancelled.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown marks every service NOT_SERVING so load balancers stop routing
+// new calls here. Later checks do not change the status back.
+func (c *Checker) Shutdown() {
+	c.alive.Store(false)
+	c.ready.Store(false)
+	c.server.Shutdown()
+}
+
+// Healthz is the HTTP liveness probe.
+func (c *Checker) Healthz(w http.ResponseWriter, _ *http.Request) {
+	writeProbe(w, c.alive.Load())
+}
+
+// Readyz is the HTTP readiness probe.
+func (c *Checker) Readyz(w http.ResponseWriter, _ *http.Request) {
+	writeProbe(w, c.ready.Load())
+}
+
+func (c *Checker) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var err error
+	if c.db != nil {
+		err = c.db.PingContext(ctx)
+	}
+	if err != nil && c.ready.Load() {
+		c.l.Error("database ping failed, marking service not ready", zap.Error(err))
+	}
+	if err == nil && !c.ready.Load() {
+		c.l.Info("database reachable, marking service ready")
+	}
+
+	c.setReady(err == nil)
+}
+
+func (c *Checker) setReady(ready bool) {
+	c.ready.Store(ready && c.alive.Load())
+
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if ready {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+
+	for _, service := range c.services {
+		c.server.SetServingStatus(service, st)
+	}
+}
+
+func writeProbe(w http.ResponseWriter, ok bool) {
+	if !ok {
+		http.Error(w, "not ok", http.StatusServiceUnavailable)
+		return
+	}
+
+	_, _ = w.Write([]byte("ok"))
+}
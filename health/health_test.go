@@ -0,0 +1,174 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/health"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const _service = "test.UserService"
+
+// pinger fails while err is set.
+type pinger struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (p *pinger) PingContext(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
+
+func (p *pinger) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+}
+
+type probe struct {
+	checker *health.Checker
+	client  healthpb.HealthClient
+}
+
+// startChecker runs a checker pinging db every few milliseconds and serves
+// its gRPC health service.
+func startChecker(t *testing.T, db health.Pinger) *probe {
+	t.Helper()
+
+	cfg := &config.Config{HealthCheckInterval: 5 * time.Millisecond, HealthCheckTimeout: time.Second}
+	checker := health.NewChecker(db, cfg, zap.NewNop(), _service)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go checker.Run(ctx)
+
+	srv := grpc.NewServer()
+	checker.Register(srv)
+
+	lis := bufconn.Listen(1 << 16)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &probe{checker: checker, client: healthpb.NewHealthClient(conn)}
+}
+
+func (p *probe) httpStatus(handler http.HandlerFunc) int {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rec.Code
+}
+
+func (p *probe) grpcStatus(t *testing.T, service string) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+
+	resp, err := p.client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("Check(%q): %v", service, err)
+	}
+
+	return resp.Status
+}
+
+// waitReady waits for the HTTP readiness probe to report want.
+func (p *probe) waitReady(t *testing.T, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.httpStatus(p.checker.Readyz) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("readiness never became %d", want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitServing waits for the gRPC status of service to become want; it is
+// set right after the HTTP probe flips.
+func (p *probe) waitServing(t *testing.T, service string, want healthpb.HealthCheckResponse_ServingStatus) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.grpcStatus(t, service) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%q never became %v", service, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShutdownMarksNotServing(t *testing.T) {
+	p := startChecker(t, nil)
+	p.waitReady(t, http.StatusOK)
+
+	for _, service := range []string{"", _service, health.LivenessService} {
+		p.waitServing(t, service, healthpb.HealthCheckResponse_SERVING)
+	}
+
+	p.checker.Shutdown()
+
+	if code := p.httpStatus(p.checker.Readyz); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz after Shutdown: %d, want 503", code)
+	}
+	if code := p.httpStatus(p.checker.Healthz); code != http.StatusServiceUnavailable {
+		t.Errorf("healthz after Shutdown: %d, want 503", code)
+	}
+
+	// later successful checks do not bring it back
+	time.Sleep(20 * time.Millisecond)
+
+	for _, service := range []string{"", _service, health.LivenessService} {
+		if st := p.grpcStatus(t, service); st != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("after Shutdown: %q is %v, want NOT_SERVING", service, st)
+		}
+	}
+	if code := p.httpStatus(p.checker.Readyz); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz after later checks: %d, want 503", code)
+	}
+}
+
+func TestFailingDatabaseFlipsReadiness(t *testing.T) {
+	db := &pinger{}
+	p := startChecker(t, db)
+	p.waitReady(t, http.StatusOK)
+
+	db.fail(errors.New("connection refused"))
+	p.waitReady(t, http.StatusServiceUnavailable)
+	p.waitServing(t, _service, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	// a database outage is not fixed by a restart, so liveness holds
+	if code := p.httpStatus(p.checker.Healthz); code != http.StatusOK {
+		t.Errorf("healthz while the database is down: %d, want 200", code)
+	}
+	if st := p.grpcStatus(t, health.LivenessService); st != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("liveness while the database is down: %v, want SERVING", st)
+	}
+
+	db.fail(nil)
+	p.waitReady(t, http.StatusOK)
+	p.waitServing(t, _service, healthpb.HealthCheckResponse_SERVING)
+}
@@ -0,0 +1,115 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/zhayt/user-service/auth"
+	userv2 "github.com/zhayt/user-service/proto/user/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyHeader is the metadata key carrying service API keys.
+const APIKeyHeader = "x-api-key"
+
+// Auth authenticates the caller from the authorization / x-api-key metadata
+// or an allow-listed client certificate, attaches the identity to the
+// context and enforces auth.Policies.
+func Auth(authenticator *auth.Authenticator, adminIdentities []string) grpc.UnaryServerInterceptor {
+	admins := make(map[string]bool, len(adminIdentities))
+	for _, identity := range adminIdentities {
+		admins[identity] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, err := authenticate(ctx, authenticator, admins)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid credentials")
+		}
+
+		if identity != nil {
+			ctx = auth.WithIdentity(ctx, identity)
+		}
+
+		if err := authorize(identity, auth.Policies[info.FullMethod], req); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func authenticate(ctx context.Context, authenticator *auth.Authenticator, admins map[string]bool) (*auth.Identity, error) {
+	// the forum gateway authenticates with its client certificate
+	for _, identity := range ClientCertIdentities(ctx) {
+		if admins[identity] {
+			return &auth.Identity{Subject: identity, Role: auth.RoleAdmin}, nil
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	identity, err := authenticator.Authenticate(first(md, "authorization"), first(md, APIKeyHeader))
+	if err == auth.ErrNoCredentials {
+		return nil, nil
+	}
+
+	return identity, err
+}
+
+func authorize(identity *auth.Identity, policy auth.Policy, req interface{}) error {
+	switch policy {
+	case auth.Public:
+		return nil
+	case auth.Admin:
+		if identity.IsAdmin() {
+			return nil
+		}
+	case auth.Service:
+		if identity.IsService() {
+			return nil
+		}
+	case auth.Self:
+		if identity.IsService() || isSelf(identity, req) {
+			return nil
+		}
+	}
+
+	if identity == nil {
+		return status.Errorf(codes.Unauthenticated, "credentials required")
+	}
+
+	return status.Errorf(codes.PermissionDenied, "caller is not allowed to perform this operation")
+}
+
+// isSelf reports whether req targets the caller's own account, by id or
+// by email.
+func isSelf(identity *auth.Identity, req interface{}) bool {
+	if identity == nil || identity.UserID == 0 {
+		return false
+	}
+
+	if r, ok := req.(interface{ GetId() uint64 }); ok {
+		return r.GetId() == identity.UserID
+	}
+
+	if r, ok := req.(interface{ GetUser() *userv2.User }); ok {
+		return r.GetUser().GetId() == identity.UserID
+	}
+
+	if r, ok := req.(interface{ GetEmail() string }); ok {
+		return identity.Email != "" && strings.EqualFold(r.GetEmail(), identity.Email)
+	}
+
+	return false
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,146 @@
+package interceptor_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/interceptor"
+	pb "github.com/zhayt/user-service/proto"
+	userv2 "github.com/zhayt/user-service/proto/user/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	_jwtSecret  = "interceptor-test-secret"
+	_serviceKey = "interceptor-test-service-key"
+	_adminKey   = "interceptor-test-admin-key"
+
+	_selfID    = 7
+	_selfEmail = "alice@example.com"
+)
+
+// userAndEmail targets a user through both GetUser and GetEmail.
+type userAndEmail struct {
+	user  *userv2.User
+	email string
+}
+
+func (r userAndEmail) GetUser() *userv2.User { return r.user }
+func (r userAndEmail) GetEmail() string      { return r.email }
+
+func userToken(t *testing.T, role string) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{
+		"sub":   strconv.Itoa(_selfID),
+		"email": _selfEmail,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	if role != "" {
+		claims["role"] = role
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(_jwtSecret))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	return "Bearer " + token
+}
+
+func TestAuthEnforcesPolicies(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(&config.Config{
+		AuthJWTSecret:   _jwtSecret,
+		AuthServiceKeys: map[string]string{"forum": _serviceKey},
+		AuthAdminKeys:   map[string]string{"ops": _adminKey},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	anonymous := metadata.MD{}
+	user := metadata.Pairs("authorization", userToken(t, ""))
+	admin := metadata.Pairs("authorization", userToken(t, auth.RoleAdmin))
+	service := metadata.Pairs(interceptor.APIKeyHeader, _serviceKey)
+	adminKey := metadata.Pairs(interceptor.APIKeyHeader, _adminKey)
+
+	const (
+		v1 = "/micro_forum_proto.UserService/"
+		v2 = "/user.v2.UserService/"
+	)
+
+	tests := []struct {
+		name   string
+		method string
+		md     metadata.MD
+		req    interface{}
+		want   codes.Code
+	}{
+		{name: "public, anonymous", method: v1 + "CreateUser", md: anonymous, want: codes.OK},
+		{name: "service, anonymous", method: v1 + "GetUserByID", md: anonymous, want: codes.Unauthenticated},
+		{name: "service, user", method: v1 + "GetUserByID", md: user, req: &pb.GetUserByIDReq{Id: _selfID}, want: codes.PermissionDenied},
+		{name: "service, service", method: v1 + "GetUserByID", md: service, want: codes.OK},
+		{name: "service, admin key", method: v1 + "GetUserByID", md: adminKey, want: codes.OK},
+		{name: "admin, service", method: v1 + "CreateWebhook", md: service, want: codes.PermissionDenied},
+		{name: "admin, user", method: v1 + "CreateWebhook", md: user, want: codes.PermissionDenied},
+		{name: "admin, admin token", method: v1 + "CreateWebhook", md: admin, want: codes.OK},
+		{name: "admin, admin key", method: v1 + "CreateWebhook", md: adminKey, want: codes.OK},
+
+		{name: "self, anonymous", method: v2 + "GetUser", md: anonymous, req: &userv2.GetUserRequest{Id: _selfID}, want: codes.Unauthenticated},
+		{name: "self, own id", method: v2 + "GetUser", md: user, req: &userv2.GetUserRequest{Id: _selfID}, want: codes.OK},
+		{name: "self, other id", method: v2 + "GetUser", md: user, req: &userv2.GetUserRequest{Id: _selfID + 1}, want: codes.PermissionDenied},
+		{name: "self, service", method: v2 + "GetUser", md: service, req: &userv2.GetUserRequest{Id: _selfID + 1}, want: codes.OK},
+		{name: "self, admin", method: v2 + "GetUser", md: admin, req: &userv2.GetUserRequest{Id: _selfID + 1}, want: codes.OK},
+		{name: "self, own user", method: v2 + "UpdateUser", md: user, req: &userv2.UpdateUserRequest{User: &userv2.User{Id: _selfID}}, want: codes.OK},
+		{name: "self, other user", method: v2 + "UpdateUser", md: user, req: &userv2.UpdateUserRequest{User: &userv2.User{Id: _selfID + 1}}, want: codes.PermissionDenied},
+		{name: "self, no user", method: v2 + "UpdateUser", md: user, req: &userv2.UpdateUserRequest{}, want: codes.PermissionDenied},
+		{name: "self, own email", method: v1 + "UpdateUserPassword", md: user, req: &pb.ChangeUserPasswordDTO{Email: "Alice@Example.com"}, want: codes.OK},
+		{name: "self, other email", method: v1 + "UpdateUserPassword", md: user, req: &pb.ChangeUserPasswordDTO{Email: "bob@example.com"}, want: codes.PermissionDenied},
+		{name: "self, no target", method: v1 + "UpdateUserPassword", md: user, req: &pb.ListWebhooksReq{}, want: codes.PermissionDenied},
+
+		// the id is checked before the email, and the user before the email
+		{name: "self, id before email", method: v1 + "UpdateUserPassword", md: user, req: &pb.User{Id: _selfID + 1, Email: _selfEmail}, want: codes.PermissionDenied},
+		{name: "self, user before email", method: v1 + "UpdateUserPassword", md: user, req: userAndEmail{user: &userv2.User{Id: _selfID + 1}, email: _selfEmail}, want: codes.PermissionDenied},
+
+		// methods missing from auth.Policies are admin-only
+		{name: "unlisted, anonymous", method: v1 + "Unlisted", md: anonymous, want: codes.Unauthenticated},
+		{name: "unlisted, user", method: v1 + "Unlisted", md: user, req: &pb.GetUserByIDReq{Id: _selfID}, want: codes.PermissionDenied},
+		{name: "unlisted, service", method: v1 + "Unlisted", md: service, want: codes.PermissionDenied},
+		{name: "unlisted, admin", method: v1 + "Unlisted", md: admin, want: codes.OK},
+	}
+
+	authorize := interceptor.Auth(authenticator, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			info := &grpc.UnaryServerInfo{FullMethod: tt.method}
+
+			_, err := authorize(ctx, tt.req, info, func(context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("code = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPoliciesCoverEveryMethod(t *testing.T) {
+	for _, desc := range []grpc.ServiceDesc{pb.UserService_ServiceDesc, userv2.UserService_ServiceDesc} {
+		for _, method := range desc.Methods {
+			name := "/" + desc.ServiceName + "/" + method.MethodName
+			if _, ok := auth.Policies[name]; !ok {
+				t.Errorf("%s has no policy and is admin-only", name)
+			}
+		}
+	}
+}
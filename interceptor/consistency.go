@@ -0,0 +1,27 @@
+package interceptor
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/zhayt/user-service/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ReadYourWritesHeader is the metadata key a client sets to "true" on a
+// call made right after a mutation, so its lookups skip the read replicas
+// and see the mutation.
+const ReadYourWritesHeader = "x-read-your-writes"
+
+// ReadYourWrites applies ReadYourWritesHeader to the request context.
+func ReadYourWrites() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if primary, _ := strconv.ParseBool(first(md, ReadYourWritesHeader)); primary {
+			ctx = storage.ReadYourWrites(ctx)
+		}
+
+		return handler(ctx, req)
+	}
+}
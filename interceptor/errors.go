@@ -0,0 +1,30 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Errors is the single place where handler errors become gRPC statuses,
+// see errs.Status. Causes hidden behind codes.Internal are logged here.
+func Errors(l *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		st := errs.Status(err)
+		if st.Code() == codes.Internal {
+			logger.FromContext(ctx, l).Error("internal error",
+				zap.String("method", info.FullMethod), zap.Error(err))
+		}
+
+		return resp, st.Err()
+	}
+}
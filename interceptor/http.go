@@ -0,0 +1,59 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// HTTP serves next inside the request id, read-your-writes, metrics, access
+// log and recovery interceptors of Unary, for HTTP APIs that call the
+// service directly rather than through gRPC. method names the calls in logs
+// and metrics. Request headers are the incoming metadata, and the request
+// id is echoed in the response headers. Authentication is left to next.
+func HTTP(method string, l *zap.Logger, next http.Handler) http.Handler {
+	chain := chainUnary(RequestID(l), ReadYourWrites(), Metrics(), AccessLog(l), Recovery(l))
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md := make(metadata.MD, len(r.Header))
+		for key, values := range r.Header {
+			md[strings.ToLower(key)] = values
+		}
+
+		ctx := metadata.NewIncomingContext(r.Context(), md)
+		if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+		}
+
+		_, err := chain(ctx, nil, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			w.Header().Set(RequestIDHeader, RequestIDFromContext(ctx))
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return nil, nil
+		})
+		if err != nil {
+			// only Recovery fails the chain
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+	})
+}
+
+// chainUnary runs interceptors outermost first around a handler.
+func chainUnary(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,27 @@
+package interceptor
+
+import (
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/config"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Unary returns the server option installing the unary interceptor chain.
+// The order matters: the request id comes first so every later log line
+// carries it, and recovery sits innermost so the access log records the
+// codes.Internal a panic is turned into. Errors translates domain errors
+// before the metrics and access log see them. Access checks run last,
+// right before the handler, so rejected calls are still logged and counted.
+func Unary(cfg *config.Config, authenticator *auth.Authenticator, l *zap.Logger) grpc.ServerOption {
+	return grpc.ChainUnaryInterceptor(
+		RequestID(l),
+		ReadYourWrites(),
+		Metrics(),
+		AccessLog(l),
+		Errors(l),
+		Recovery(l),
+		Auth(authenticator, cfg.TLSAdminIdentities),
+		ClientCertAllowList(cfg.TLSAdminIdentities),
+	)
+}
@@ -0,0 +1,161 @@
+package interceptor_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zhayt/user-service/interceptor"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var _info = &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+// chain runs handler inside interceptors, outermost first.
+func chain(ctx context.Context, handler grpc.UnaryHandler, interceptors ...grpc.UnaryServerInterceptor) (interface{}, error) {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, _info, next)
+		}
+	}
+
+	return handler(ctx, nil)
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming metadata.MD
+		want     string
+	}{
+		{name: "propagated", incoming: metadata.Pairs(interceptor.RequestIDHeader, "req-1"), want: "req-1"},
+		{name: "generated when missing"},
+		{name: "generated when too long", incoming: metadata.Pairs(interceptor.RequestIDHeader, string(make([]byte, 129)))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.incoming != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.incoming)
+			}
+
+			var got string
+			_, _ = chain(ctx, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				got = interceptor.RequestIDFromContext(ctx)
+				return nil, nil
+			}, interceptor.RequestID(zap.NewNop()))
+
+			if tt.want != "" && got != tt.want {
+				t.Errorf("request id = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" && len(got) != 32 {
+				t.Errorf("generated request id = %q, want 32 hex digits", got)
+			}
+		})
+	}
+}
+
+func TestRecoveryTurnsPanicIntoInternal(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+
+	_, err := chain(context.Background(), func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	}, interceptor.Recovery(zap.New(core)))
+
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("error = %v, want Internal", err)
+	}
+
+	if status.Convert(err).Message() == "boom" {
+		t.Error("the panic value reached the client")
+	}
+
+	if logs.FilterMessage("panic in handler").Len() != 1 {
+		t.Errorf("panic not logged: %v", logs.All())
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	l := zap.New(core)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(interceptor.RequestIDHeader, "req-2"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242}})
+
+	_, _ = chain(ctx, func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no such user")
+	}, interceptor.RequestID(l), interceptor.AccessLog(l))
+
+	entries := logs.FilterMessage("grpc request").All()
+	if len(entries) != 1 {
+		t.Fatalf("access log entries = %v, want one", logs.All())
+	}
+
+	entry := entries[0]
+	if entry.Level != zapcore.WarnLevel {
+		t.Errorf("level = %v, want warn for NotFound", entry.Level)
+	}
+
+	fields := entry.ContextMap()
+	for key, want := range map[string]interface{}{
+		"method":     _info.FullMethod,
+		"code":       "NotFound",
+		"peer":       "10.0.0.1:4242",
+		"request_id": "req-2",
+	} {
+		if fields[key] != want {
+			t.Errorf("%s = %v, want %v", key, fields[key], want)
+		}
+	}
+
+	if _, ok := fields["latency"]; !ok {
+		t.Error("latency not logged")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	handler := interceptor.HTTP("/graphql", zap.New(core), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("panic") != "" {
+			panic("boom")
+		}
+		_, _ = w.Write([]byte(interceptor.RequestIDFromContext(r.Context())))
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+	req.Header.Set("X-Request-Id", "req-3")
+	handler.ServeHTTP(rec, req)
+
+	if rec.Body.String() != "req-3" || rec.Header().Get("X-Request-Id") != "req-3" {
+		t.Errorf("request id: body %q, header %q, want req-3", rec.Body.String(), rec.Header().Get("X-Request-Id"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql?panic=1", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("panic: status %d, want 500", rec.Code)
+	}
+
+	codes := make([]interface{}, 0, 2)
+	for _, entry := range logs.FilterMessage("grpc request").All() {
+		codes = append(codes, entry.ContextMap()["code"])
+	}
+
+	if len(codes) != 2 || codes[0] != "OK" || codes[1] != "Internal" {
+		t.Errorf("access log codes = %v, want [OK Internal]", codes)
+	}
+}
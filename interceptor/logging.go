@@ -0,0 +1,45 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"github.com/zhayt/user-service/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AccessLog writes one structured line per call with the method, status
+// code, latency and peer address.
+func AccessLog(l *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		fields := []zap.Field{
+			zap.String("method", info.FullMethod),
+			zap.String("code", code.String()),
+			zap.Duration("latency", time.Since(start)),
+		}
+
+		if p, ok := peer.FromContext(ctx); ok {
+			fields = append(fields, zap.String("peer", p.Addr.String()))
+		}
+
+		log := logger.FromContext(ctx, l)
+		switch code {
+		case codes.OK:
+			log.Info("grpc request", fields...)
+		case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+			log.Error("grpc request", fields...)
+		default:
+			log.Warn("grpc request", fields...)
+		}
+
+		return resp, err
+	}
+}
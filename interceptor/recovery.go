@@ -0,0 +1,27 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/zhayt/user-service/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Recovery turns a panic in a handler into codes.Internal instead of
+// crashing the process. The panic value and stack are only logged.
+func Recovery(l *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.FromContext(ctx, l).Error("panic in handler",
+					zap.String("method", info.FullMethod), zap.Any("panic", r), zap.Stack("stack"))
+				err = status.Errorf(codes.Internal, "internal error")
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
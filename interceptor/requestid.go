@@ -0,0 +1,65 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/zhayt/user-service/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader is the metadata key carrying the request id, both on the
+// way in and in the response headers.
+const RequestIDHeader = "x-request-id"
+
+const _maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestID takes the request id from incoming metadata or generates one,
+// echoes it back in the response headers and attaches a logger tagged with
+// it to the context, so handlers log with the request id automatically.
+func RequestID(l *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := incomingRequestID(ctx)
+		if id == "" {
+			id = newRequestID()
+		}
+
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+		ctx = context.WithValue(ctx, requestIDKey{}, id)
+		ctx = logger.WithContext(ctx, l.With(zap.String("request_id", id)))
+
+		return handler(ctx, req)
+	}
+}
+
+// RequestIDFromContext returns the id assigned by the RequestID interceptor.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func incomingRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(RequestIDHeader)
+	if len(values) == 0 || len(values[0]) > _maxRequestIDLen {
+		return ""
+	}
+
+	return values[0]
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,72 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AdminMethods are the RPCs restricted to allow-listed client certificates.
+var AdminMethods = map[string]bool{
+	"/micro_forum_proto.UserService/CreateWebhook":            true,
+	"/micro_forum_proto.UserService/ListWebhooks":             true,
+	"/micro_forum_proto.UserService/DeleteWebhook":            true,
+	"/micro_forum_proto.UserService/ListWebhookDeadLetters":   true,
+	"/micro_forum_proto.UserService/ReplayWebhookDeadLetters": true,
+}
+
+// ClientCertAllowList rejects calls to AdminMethods unless the caller
+// presented a verified client certificate whose subject common name or one
+// of whose SANs is in allowed. An empty allowed list disables the check.
+func ClientCertAllowList(allowed []string) grpc.UnaryServerInterceptor {
+	allow := make(map[string]bool, len(allowed))
+	for _, identity := range allowed {
+		allow[identity] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if len(allow) == 0 || !AdminMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		for _, identity := range ClientCertIdentities(ctx) {
+			if allow[identity] {
+				return handler(ctx, req)
+			}
+		}
+
+		return nil, status.Errorf(codes.PermissionDenied, "client certificate is not allowed to call %s", info.FullMethod)
+	}
+}
+
+// ClientCertIdentities returns the subject common name and SANs (DNS,
+// URI and email) of the verified client certificate, if any.
+func ClientCertIdentities(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		return nil
+	}
+
+	cert := tlsInfo.State.VerifiedChains[0][0]
+
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+
+	return identities
+}
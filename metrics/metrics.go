@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "user_service"
+
+var (
+	// Registry holds every collector exposed on /metrics.
+	Registry = prometheus.NewRegistry()
+
+	RPCHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_handled_total",
+		Help:      "Total number of RPCs completed, by method and status code.",
+	}, []string{"method", "code"})
+
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_handling_seconds",
+		Help:      "RPC latency, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	PasswordHashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Time spent hashing or comparing passwords, by operation.",
+		// bcrypt at the default cost takes tens of milliseconds
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+
+	UsersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "users_created_total",
+		Help:      "Total number of users created.",
+	})
+
+	PasswordCheckFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "password_check_failures_total",
+		Help:      "Total number of password checks that did not match.",
+	})
+
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_cache_requests_total",
+		Help:      "Total number of user cache lookups, by result (hit, negative_hit or miss).",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RPCHandled,
+		RPCDuration,
+		PasswordHashDuration,
+		UsersCreated,
+		PasswordCheckFailures,
+		CacheRequests,
+	)
+}
+
+// RegisterDB exposes the connection pool stats of db (open, in use, idle,
+// wait count and wait time).
+func RegisterDB(db *sqlx.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db.DB, name))
+}
+
+// RegisterCacheSize exposes the number of entries in the user cache.
+func RegisterCacheSize(size func() int) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "user_cache_entries",
+		Help:      "Number of users and not-found results in the user cache.",
+	}, func() float64 { return float64(size()) }))
+}
+
+// Handler serves the collectors in Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -3,10 +3,14 @@ package dto
 import pb "github.com/zhayt/user-service/proto"
 
 type ChangeUserPasswordDTO struct {
-	Email              string `validator:"required"`
-	OldPassword        string `validator:"required"`
-	NewPassword        string `validator:"required,eqfield=ConfirmNewPassword""`
+	// ID is resolved from Email for the deprecated email-keyed RPC
+	ID                 uint64 `validate:"required_without=Email"`
+	Email              string `validate:"required_without=ID,omitempty,email"`
+	OldPassword        string `validate:"required"`
+	NewPassword        string `validate:"required,eqfield=ConfirmNewPassword"`
 	ConfirmNewPassword string `validate:"required"`
+	// ExpectedVersion makes the update conditional; zero updates blindly
+	ExpectedVersion uint64
 }
 
 func NewChangeUserPasswordDTO(dto *pb.ChangeUserPasswordDTO) *ChangeUserPasswordDTO {
@@ -15,17 +19,41 @@ func NewChangeUserPasswordDTO(dto *pb.ChangeUserPasswordDTO) *ChangeUserPassword
 		OldPassword:        dto.OldPassword,
 		NewPassword:        dto.NewPassword,
 		ConfirmNewPassword: dto.ConfirmNewPassword,
+		ExpectedVersion:    dto.ExpectedVersion,
+	}
+}
+
+func NewChangeUserPasswordByIDDTO(dto *pb.ChangeUserPasswordByIDReq) *ChangeUserPasswordDTO {
+	return &ChangeUserPasswordDTO{
+		ID:                 dto.Id,
+		OldPassword:        dto.OldPassword,
+		NewPassword:        dto.NewPassword,
+		ConfirmNewPassword: dto.ConfirmNewPassword,
+		ExpectedVersion:    dto.ExpectedVersion,
 	}
 }
 
 type ChangeUserNameDTO struct {
-	Email string `validator:"required"`
-	Name  string `validator:"required,min=3,max=50"`
+	// ID is resolved from Email for the deprecated email-keyed RPC
+	ID    uint64 `validate:"required_without=Email"`
+	Email string `validate:"required_without=ID,omitempty,email"`
+	Name  string `validate:"required,min=3,max=50" json:"new_name"`
+	// ExpectedVersion makes the update conditional; zero updates blindly
+	ExpectedVersion uint64
 }
 
 func NewChangeUserNameDTO(dto *pb.ChangeUserNameDTO) *ChangeUserNameDTO {
 	return &ChangeUserNameDTO{
-		Email: dto.Email,
-		Name:  dto.NewName,
+		Email:           dto.Email,
+		Name:            dto.NewName,
+		ExpectedVersion: dto.ExpectedVersion,
+	}
+}
+
+func NewChangeUserNameByIDDTO(dto *pb.ChangeUserNameByIDReq) *ChangeUserNameDTO {
+	return &ChangeUserNameDTO{
+		ID:              dto.Id,
+		Name:            dto.NewName,
+		ExpectedVersion: dto.ExpectedVersion,
 	}
 }
@@ -1,12 +1,33 @@
 package model
 
-import pb "github.com/zhayt/user-service/proto"
+import (
+	pb "github.com/zhayt/user-service/proto"
+	"time"
+)
 
 type User struct {
 	ID       uint64
 	Name     string `validate:"required,alpha,min=3,max=50"`
 	Email    string `validate:"required,lowercase"`
 	Password string `validate:"required"`
+	// Version is incremented on every update and used as the etag
+	Version     uint64
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at"`
+	LastLoginAt *time.Time `db:"last_login_at"`
+}
+
+// UserFilter selects users in searches. Nil bounds are not applied.
+type UserFilter struct {
+	// Query matches users whose name contains it
+	Query          string
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	LastLoginAfter *time.Time
+	// LastLoginBefore also matches users who never logged in
+	LastLoginBefore *time.Time
+	Limit           int
+	Offset          int
 }
 
 func NewUser(user *pb.User) *User {
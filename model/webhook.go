@@ -0,0 +1,78 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	pb "github.com/zhayt/user-service/proto"
+)
+
+// Webhook event types published by the user service.
+const (
+	EventUserCreated         = "user.created"
+	EventUserNameUpdated     = "user.name_updated"
+	EventUserPasswordUpdated = "user.password_updated"
+)
+
+type Webhook struct {
+	ID     uint64
+	URL    string   `validate:"required,url"`
+	Secret string   `validate:"required,min=16"`
+	Events []string `validate:"required,min=1,dive,oneof=user.created user.name_updated user.password_updated"`
+}
+
+func NewWebhook(webhook *pb.Webhook) *Webhook {
+	return &Webhook{
+		ID:     webhook.Id,
+		URL:    webhook.Url,
+		Secret: webhook.Secret,
+		Events: webhook.Events,
+	}
+}
+
+// Subscribed reports whether the webhook wants events of the given type.
+func (w *Webhook) Subscribed(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JoinEvents and SplitEvents convert the event list to and from the
+// comma separated form kept in storage.
+func JoinEvents(events []string) string {
+	return strings.Join(events, ",")
+}
+
+func SplitEvents(events string) []string {
+	if events == "" {
+		return nil
+	}
+
+	return strings.Split(events, ",")
+}
+
+type WebhookEvent struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+type UserEventData struct {
+	ID    uint64 `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type WebhookDeadLetter struct {
+	ID        uint64 `db:"id"`
+	WebhookID uint64 `db:"webhook_id"`
+	EventType string `db:"event_type"`
+	Payload   string `db:"payload"`
+	Attempts  uint32 `db:"attempts"`
+	LastError string `db:"last_error"`
+}
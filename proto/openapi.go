@@ -0,0 +1,9 @@
+package micro_forum_proto
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI v2 document generated from user.proto and
+// user_api.yaml alongside the REST gateway.
+//
+//go:embed user.swagger.json
+var OpenAPI []byte
@@ -25,8 +25,21 @@ type UserServiceClient interface {
 	CreateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*UserProfileDTO, error)
 	GetUserByID(ctx context.Context, in *GetUserByIDReq, opts ...grpc.CallOption) (*User, error)
 	GetUserByEmail(ctx context.Context, in *GetUserByEmailReq, opts ...grpc.CallOption) (*User, error)
+	// Deprecated: Do not use.
+	// Deprecated: use UpdateUserPasswordByID.
 	UpdateUserPassword(ctx context.Context, in *ChangeUserPasswordDTO, opts ...grpc.CallOption) (*UserUpdateResponse, error)
+	// Deprecated: Do not use.
+	// Deprecated: use UpdateUserNameByID.
 	UpdateUserName(ctx context.Context, in *ChangeUserNameDTO, opts ...grpc.CallOption) (*UserUpdateResponse, error)
+	UpdateUserPasswordByID(ctx context.Context, in *ChangeUserPasswordByIDReq, opts ...grpc.CallOption) (*UserUpdateResponse, error)
+	UpdateUserNameByID(ctx context.Context, in *ChangeUserNameByIDReq, opts ...grpc.CallOption) (*UserUpdateResponse, error)
+	// RecordLogin is called by the forum gateway after a successful login.
+	RecordLogin(ctx context.Context, in *RecordLoginReq, opts ...grpc.CallOption) (*UserUpdateResponse, error)
+	CreateWebhook(ctx context.Context, in *Webhook, opts ...grpc.CallOption) (*Webhook, error)
+	ListWebhooks(ctx context.Context, in *ListWebhooksReq, opts ...grpc.CallOption) (*WebhookList, error)
+	DeleteWebhook(ctx context.Context, in *WebhookIDReq, opts ...grpc.CallOption) (*UserUpdateResponse, error)
+	ListWebhookDeadLetters(ctx context.Context, in *ListWebhookDeadLettersReq, opts ...grpc.CallOption) (*WebhookDeadLetterList, error)
+	ReplayWebhookDeadLetters(ctx context.Context, in *ReplayWebhookDeadLettersReq, opts ...grpc.CallOption) (*ReplayWebhookDeadLettersResponse, error)
 }
 
 type userServiceClient struct {
@@ -64,6 +77,7 @@ func (c *userServiceClient) GetUserByEmail(ctx context.Context, in *GetUserByEma
 	return out, nil
 }
 
+// Deprecated: Do not use.
 func (c *userServiceClient) UpdateUserPassword(ctx context.Context, in *ChangeUserPasswordDTO, opts ...grpc.CallOption) (*UserUpdateResponse, error) {
 	out := new(UserUpdateResponse)
 	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/UpdateUserPassword", in, out, opts...)
@@ -73,6 +87,7 @@ func (c *userServiceClient) UpdateUserPassword(ctx context.Context, in *ChangeUs
 	return out, nil
 }
 
+// Deprecated: Do not use.
 func (c *userServiceClient) UpdateUserName(ctx context.Context, in *ChangeUserNameDTO, opts ...grpc.CallOption) (*UserUpdateResponse, error) {
 	out := new(UserUpdateResponse)
 	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/UpdateUserName", in, out, opts...)
@@ -82,6 +97,78 @@ func (c *userServiceClient) UpdateUserName(ctx context.Context, in *ChangeUserNa
 	return out, nil
 }
 
+func (c *userServiceClient) UpdateUserPasswordByID(ctx context.Context, in *ChangeUserPasswordByIDReq, opts ...grpc.CallOption) (*UserUpdateResponse, error) {
+	out := new(UserUpdateResponse)
+	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/UpdateUserPasswordByID", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) UpdateUserNameByID(ctx context.Context, in *ChangeUserNameByIDReq, opts ...grpc.CallOption) (*UserUpdateResponse, error) {
+	out := new(UserUpdateResponse)
+	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/UpdateUserNameByID", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) RecordLogin(ctx context.Context, in *RecordLoginReq, opts ...grpc.CallOption) (*UserUpdateResponse, error) {
+	out := new(UserUpdateResponse)
+	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/RecordLogin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) CreateWebhook(ctx context.Context, in *Webhook, opts ...grpc.CallOption) (*Webhook, error) {
+	out := new(Webhook)
+	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/CreateWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ListWebhooks(ctx context.Context, in *ListWebhooksReq, opts ...grpc.CallOption) (*WebhookList, error) {
+	out := new(WebhookList)
+	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/ListWebhooks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) DeleteWebhook(ctx context.Context, in *WebhookIDReq, opts ...grpc.CallOption) (*UserUpdateResponse, error) {
+	out := new(UserUpdateResponse)
+	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/DeleteWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ListWebhookDeadLetters(ctx context.Context, in *ListWebhookDeadLettersReq, opts ...grpc.CallOption) (*WebhookDeadLetterList, error) {
+	out := new(WebhookDeadLetterList)
+	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/ListWebhookDeadLetters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ReplayWebhookDeadLetters(ctx context.Context, in *ReplayWebhookDeadLettersReq, opts ...grpc.CallOption) (*ReplayWebhookDeadLettersResponse, error) {
+	out := new(ReplayWebhookDeadLettersResponse)
+	err := c.cc.Invoke(ctx, "/micro_forum_proto.UserService/ReplayWebhookDeadLetters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserServiceServer is the server API for UserService service.
 // All implementations must embed UnimplementedUserServiceServer
 // for forward compatibility
@@ -89,8 +176,21 @@ type UserServiceServer interface {
 	CreateUser(context.Context, *User) (*UserProfileDTO, error)
 	GetUserByID(context.Context, *GetUserByIDReq) (*User, error)
 	GetUserByEmail(context.Context, *GetUserByEmailReq) (*User, error)
+	// Deprecated: Do not use.
+	// Deprecated: use UpdateUserPasswordByID.
 	UpdateUserPassword(context.Context, *ChangeUserPasswordDTO) (*UserUpdateResponse, error)
+	// Deprecated: Do not use.
+	// Deprecated: use UpdateUserNameByID.
 	UpdateUserName(context.Context, *ChangeUserNameDTO) (*UserUpdateResponse, error)
+	UpdateUserPasswordByID(context.Context, *ChangeUserPasswordByIDReq) (*UserUpdateResponse, error)
+	UpdateUserNameByID(context.Context, *ChangeUserNameByIDReq) (*UserUpdateResponse, error)
+	// RecordLogin is called by the forum gateway after a successful login.
+	RecordLogin(context.Context, *RecordLoginReq) (*UserUpdateResponse, error)
+	CreateWebhook(context.Context, *Webhook) (*Webhook, error)
+	ListWebhooks(context.Context, *ListWebhooksReq) (*WebhookList, error)
+	DeleteWebhook(context.Context, *WebhookIDReq) (*UserUpdateResponse, error)
+	ListWebhookDeadLetters(context.Context, *ListWebhookDeadLettersReq) (*WebhookDeadLetterList, error)
+	ReplayWebhookDeadLetters(context.Context, *ReplayWebhookDeadLettersReq) (*ReplayWebhookDeadLettersResponse, error)
 	mustEmbedUnimplementedUserServiceServer()
 }
 
@@ -113,6 +213,30 @@ func (UnimplementedUserServiceServer) UpdateUserPassword(context.Context, *Chang
 func (UnimplementedUserServiceServer) UpdateUserName(context.Context, *ChangeUserNameDTO) (*UserUpdateResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateUserName not implemented")
 }
+func (UnimplementedUserServiceServer) UpdateUserPasswordByID(context.Context, *ChangeUserPasswordByIDReq) (*UserUpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUserPasswordByID not implemented")
+}
+func (UnimplementedUserServiceServer) UpdateUserNameByID(context.Context, *ChangeUserNameByIDReq) (*UserUpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUserNameByID not implemented")
+}
+func (UnimplementedUserServiceServer) RecordLogin(context.Context, *RecordLoginReq) (*UserUpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RecordLogin not implemented")
+}
+func (UnimplementedUserServiceServer) CreateWebhook(context.Context, *Webhook) (*Webhook, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWebhook not implemented")
+}
+func (UnimplementedUserServiceServer) ListWebhooks(context.Context, *ListWebhooksReq) (*WebhookList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhooks not implemented")
+}
+func (UnimplementedUserServiceServer) DeleteWebhook(context.Context, *WebhookIDReq) (*UserUpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhook not implemented")
+}
+func (UnimplementedUserServiceServer) ListWebhookDeadLetters(context.Context, *ListWebhookDeadLettersReq) (*WebhookDeadLetterList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWebhookDeadLetters not implemented")
+}
+func (UnimplementedUserServiceServer) ReplayWebhookDeadLetters(context.Context, *ReplayWebhookDeadLettersReq) (*ReplayWebhookDeadLettersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplayWebhookDeadLetters not implemented")
+}
 func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
 
 // UnsafeUserServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -216,6 +340,150 @@ func _UserService_UpdateUserName_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_UpdateUserPasswordByID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeUserPasswordByIDReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).UpdateUserPasswordByID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/micro_forum_proto.UserService/UpdateUserPasswordByID",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).UpdateUserPasswordByID(ctx, req.(*ChangeUserPasswordByIDReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_UpdateUserNameByID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeUserNameByIDReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).UpdateUserNameByID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/micro_forum_proto.UserService/UpdateUserNameByID",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).UpdateUserNameByID(ctx, req.(*ChangeUserNameByIDReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_RecordLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecordLoginReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).RecordLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/micro_forum_proto.UserService/RecordLogin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).RecordLogin(ctx, req.(*RecordLoginReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_CreateWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Webhook)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).CreateWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/micro_forum_proto.UserService/CreateWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).CreateWebhook(ctx, req.(*Webhook))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ListWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhooksReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ListWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/micro_forum_proto.UserService/ListWebhooks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ListWebhooks(ctx, req.(*ListWebhooksReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_DeleteWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebhookIDReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).DeleteWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/micro_forum_proto.UserService/DeleteWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).DeleteWebhook(ctx, req.(*WebhookIDReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ListWebhookDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookDeadLettersReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ListWebhookDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/micro_forum_proto.UserService/ListWebhookDeadLetters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ListWebhookDeadLetters(ctx, req.(*ListWebhookDeadLettersReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ReplayWebhookDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplayWebhookDeadLettersReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ReplayWebhookDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/micro_forum_proto.UserService/ReplayWebhookDeadLetters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ReplayWebhookDeadLetters(ctx, req.(*ReplayWebhookDeadLettersReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -243,6 +511,38 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateUserName",
 			Handler:    _UserService_UpdateUserName_Handler,
 		},
+		{
+			MethodName: "UpdateUserPasswordByID",
+			Handler:    _UserService_UpdateUserPasswordByID_Handler,
+		},
+		{
+			MethodName: "UpdateUserNameByID",
+			Handler:    _UserService_UpdateUserNameByID_Handler,
+		},
+		{
+			MethodName: "RecordLogin",
+			Handler:    _UserService_RecordLogin_Handler,
+		},
+		{
+			MethodName: "CreateWebhook",
+			Handler:    _UserService_CreateWebhook_Handler,
+		},
+		{
+			MethodName: "ListWebhooks",
+			Handler:    _UserService_ListWebhooks_Handler,
+		},
+		{
+			MethodName: "DeleteWebhook",
+			Handler:    _UserService_DeleteWebhook_Handler,
+		},
+		{
+			MethodName: "ListWebhookDeadLetters",
+			Handler:    _UserService_ListWebhookDeadLetters_Handler,
+		},
+		{
+			MethodName: "ReplayWebhookDeadLetters",
+			Handler:    _UserService_ReplayWebhookDeadLetters_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "user.proto",
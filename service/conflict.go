@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/storage"
+	"go.uber.org/zap"
+)
+
+// versionConflictError carries the current user state out of the shared
+// update helpers; each API version attaches it in its own message type.
+type versionConflictError struct {
+	current *model.User
+}
+
+func (e *versionConflictError) Error() string {
+	return "user was modified concurrently"
+}
+
+// checkVersion fails early when the caller's expected version is already
+// stale, saving a hash and a write.
+func checkVersion(user *model.User, expected uint64) error {
+	if expected != 0 && expected != user.Version {
+		return &versionConflictError{current: user}
+	}
+
+	return nil
+}
+
+// versionConflict reloads the user through users when a conditional update
+// lost a race and passes other update errors through.
+func (s *UserService) versionConflict(ctx context.Context, users storage.IStorage, id uint64, err error) error {
+	if !errors.Is(err, errs.ErrVersionConflict) {
+		return err
+	}
+
+	current, err := users.GetUserByID(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("GetUserByID error", zap.Error(err))
+		return errs.UserVersionConflict()
+	}
+
+	return &versionConflictError{current: current}
+}
+
+// withCurrentProfile turns a version conflict into errs.ErrVersionConflict
+// with the current profile attached and passes other errors through.
+func withCurrentProfile(err error) error {
+	var conflict *versionConflictError
+	if !errors.As(err, &conflict) {
+		return err
+	}
+
+	return errs.New(errs.ErrVersionConflict, errs.ReasonVersionConflict, conflict.Error()).
+		WithDetails(newProfilePB(conflict.current))
+}
@@ -0,0 +1,12 @@
+package service
+
+import (
+	"fmt"
+	"github.com/zhayt/user-service/errs"
+)
+
+var errInvalidUserID = errs.New(errs.ErrInvalidArgument, errs.ReasonInvalidArgument, "invalid user id")
+
+func invalidArgumentf(format string, args ...interface{}) error {
+	return errs.New(errs.ErrInvalidArgument, errs.ReasonInvalidArgument, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,117 @@
+// Package servicetest builds the user service over in-memory storage for
+// the tests of the API surfaces, which add only their own transport:
+//
+//	f := servicetest.New(t, func(cfg *config.Config) {
+//		cfg.LegacyEmailMutations = true
+//	})
+//	grpcServer := f.GRPCServer()
+package servicetest
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/interceptor"
+	pb "github.com/zhayt/user-service/proto"
+	userv2 "github.com/zhayt/user-service/proto/user/v2"
+	"github.com/zhayt/user-service/service"
+	"github.com/zhayt/user-service/storage"
+	"github.com/zhayt/user-service/webhook"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Credentials accepted by every fixture.
+const (
+	JWTSecret  = "servicetest-jwt-secret"
+	ServiceKey = "servicetest-service-key"
+	AdminKey   = "servicetest-admin-key"
+)
+
+// Fixture is a user service and what the API surfaces are built from.
+type Fixture struct {
+	Config        *config.Config
+	Storage       *storage.Storage
+	Users         *service.UserService
+	Authenticator *auth.Authenticator
+	Logger        *zap.Logger
+}
+
+// New builds a fixture over in-memory storage. override, when not nil,
+// adjusts the default config before anything is built from it.
+func New(t testing.TB, override func(cfg *config.Config)) *Fixture {
+	t.Helper()
+
+	return NewWithStorage(t, storage.NewMemoryStorage(zap.NewNop()), override)
+}
+
+// NewWithStorage builds a fixture over repo.
+func NewWithStorage(t testing.TB, repo *storage.Storage, override func(cfg *config.Config)) *Fixture {
+	t.Helper()
+
+	cfg := &config.Config{
+		AuthJWTSecret:    JWTSecret,
+		AuthServiceKeys:  map[string]string{"forum": ServiceKey},
+		AuthAdminKeys:    map[string]string{"ops": AdminKey},
+		WebhookQueueSize: 16,
+	}
+	if override != nil {
+		override(cfg)
+	}
+
+	l := zap.NewNop()
+
+	validate, err := service.NewValidateService()
+	if err != nil {
+		t.Fatalf("NewValidateService: %v", err)
+	}
+
+	authenticator, err := auth.NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	return &Fixture{
+		Config:        cfg,
+		Storage:       repo,
+		Users:         service.NewUserService(repo, validate, webhook.NewDispatcher(repo, http.DefaultClient, cfg, l), cfg, l),
+		Authenticator: authenticator,
+		Logger:        l,
+	}
+}
+
+// GRPCServer returns a server with the production interceptor chain and
+// both user service versions registered.
+func (f *Fixture) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(append([]grpc.ServerOption{interceptor.Unary(f.Config, f.Authenticator, f.Logger)}, opts...)...)
+	pb.RegisterUserServiceServer(srv, f.Users)
+	userv2.RegisterUserServiceServer(srv, service.NewUserServiceV2(f.Users))
+
+	return srv
+}
+
+// UserToken signs a bearer token for the user with the given id and role;
+// an empty role is a regular user.
+func UserToken(t testing.TB, id uint64, role string) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{
+		"sub": strconv.FormatUint(id, 10),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if role != "" {
+		claims["role"] = role
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(JWTSecret))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	return token
+}
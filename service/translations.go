@@ -0,0 +1,75 @@
+package service
+
+import (
+	"reflect"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+// extraTranslations fills the gaps in the validator's bundled en and ru
+// translations and provides kk, which it does not ship. Placeholders: {0}
+// is the field, {1} the tag parameter; they must appear in that order.
+var extraTranslations = map[string]map[string]string{
+	"en": {
+		"required_without": "{0} is required when {1} is not set",
+	},
+	"ru": {
+		"required_without": "{0} обязательное поле, если не указано {1}",
+		"lowercase":        "{0} должно быть строкой в нижнем регистре",
+	},
+	"kk": {
+		"required":         "{0} міндетті өріс",
+		"required_without": "{0} міндетті өріс, егер {1} көрсетілмесе",
+		"min":              "{0} ұзындығы кемінде {1} таңба болуы керек",
+		"min-items":        "{0} кемінде {1} элементтен тұруы керек",
+		"max":              "{0} ұзындығы {1} таңбадан аспауы керек",
+		"max-items":        "{0} {1} элементтен аспауы керек",
+		"alpha":            "{0} тек әріптерден тұруы керек",
+		"lowercase":        "{0} кіші әріптермен жазылуы керек",
+		"email":            "{0} жарамды email мекенжайы болуы керек",
+		"url":              "{0} жарамды URL болуы керек",
+		"eqfield":          "{0} {1} өрісімен сәйкес келуі керек",
+		"oneof":            "{0} мына мәндердің бірі болуы керек: [{1}]",
+	},
+}
+
+func registerExtraTranslations(v *validator.Validate, trans ut.Translator) error {
+	for tag, text := range extraTranslations[trans.Locale()] {
+		if err := trans.Add(tag, text, true); err != nil {
+			return err
+		}
+
+		if tag == "min-items" || tag == "max-items" {
+			continue
+		}
+
+		if err := v.RegisterTranslation(tag, trans, noopRegister, translateField); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func noopRegister(ut.Translator) error {
+	return nil
+}
+
+// translateField renders the message for fe, using the -items variant of
+// min and max for slices and maps when the locale has one.
+func translateField(trans ut.Translator, fe validator.FieldError) string {
+	key := fe.Tag()
+	if kind := fe.Kind(); (key == "min" || key == "max") && (kind == reflect.Slice || kind == reflect.Map) {
+		if _, ok := extraTranslations[trans.Locale()][key+"-items"]; ok {
+			key += "-items"
+		}
+	}
+
+	msg, err := trans.T(key, fe.Field(), fe.Param())
+	if err != nil {
+		return fe.Error()
+	}
+
+	return msg
+}
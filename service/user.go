@@ -2,169 +2,448 @@ package service
 
 import (
 	"context"
-	"database/sql"
-	"errors"
 	"fmt"
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/logger"
+	"github.com/zhayt/user-service/metrics"
 	"github.com/zhayt/user-service/model"
 	"github.com/zhayt/user-service/model/dto"
 	pb "github.com/zhayt/user-service/proto"
 	"github.com/zhayt/user-service/storage"
+	"github.com/zhayt/user-service/webhook"
 	"go.uber.org/zap"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"time"
 )
 
-const _defaultContextTimeout = 5 * time.Second
+const (
+	_defaultContextTimeout = 5 * time.Second
+	_maxSearchLimit        = 100
+)
 
 type UserService struct {
 	pb.UnimplementedUserServiceServer
 	storage  *storage.Storage
 	validate *ValidateService
-	l        *zap.Logger
+	webhooks *webhook.Dispatcher
+	// legacyEmailMutations keeps the deprecated email-keyed mutations enabled
+	legacyEmailMutations bool
+	l                    *zap.Logger
 }
 
-func NewUserService(storage *storage.Storage, validate *ValidateService, l *zap.Logger) *UserService {
-	return &UserService{storage: storage, validate: validate, l: l}
+func NewUserService(storage *storage.Storage, validate *ValidateService, webhooks *webhook.Dispatcher, cfg *config.Config, l *zap.Logger) *UserService {
+	return &UserService{
+		storage:              storage,
+		validate:             validate,
+		webhooks:             webhooks,
+		legacyEmailMutations: cfg.LegacyEmailMutations,
+		l:                    l,
+	}
+}
+
+// withDefaultTimeout bounds calls whose context carries no deadline, such
+// as those from in-process callers, by _defaultContextTimeout.
+func withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, _defaultContextTimeout)
+}
+
+// log returns the request-scoped logger set up by the interceptors.
+func (s *UserService) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.l)
 }
 
 func (s *UserService) CreateUser(ctx context.Context, userPB *pb.User) (*pb.UserProfileDTO, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
 	// convert proto struct to golang struct
 	user := model.NewUser(userPB)
 
 	// validate struct data
-	if err := s.validate.validateStruct(user); err != nil {
-		s.l.Error("validateStruct error", zap.Error(err))
-		return nil, status.Errorf(codes.InvalidArgument, "failed to validate struct: %w", err)
+	if err := s.validate.validateStruct(ctx, user); err != nil {
+		s.log(ctx).Error("validateStruct error", zap.Error(err))
+		return nil, err
 	}
 
-	user.Password = generatePassword(user.Password)
+	user.Password = generatePassword(ctx, user.Password)
 	// try to create user
 	userID, err := s.storage.CreateUser(ctx, user)
 	if err != nil {
-		s.l.Error("CreateUser error", zap.Error(err))
-		return nil, status.Errorf(codes.Internal, "failed to create user: %w", err)
+		s.log(ctx).Error("CreateUser error", zap.Error(err))
+		return nil, err
 	}
 
-	s.l.Info("User created", zap.Uint64("id", userID))
-	return &pb.UserProfileDTO{
-		Id:    userID,
-		Name:  user.Name,
-		Email: user.Email,
-	}, nil
+	metrics.UsersCreated.Inc()
+	s.webhooks.Publish(ctx, model.EventUserCreated, model.UserEventData{ID: userID, Name: user.Name, Email: user.Email})
+
+	s.log(ctx).Info("User created", zap.Uint64("id", userID))
+	return newProfilePB(user), nil
 }
 
 func (s *UserService) GetUserByID(ctx context.Context, req *pb.GetUserByIDReq) (*pb.User, error) {
 	if req.Id <= 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid user id")
+		return nil, errInvalidUserID
 	}
 
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
 	user, err := s.storage.GetUserByID(ctx, req.Id)
 	if err != nil {
-		s.l.Error("GetUserByID error", zap.Error(err))
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, status.Errorf(codes.NotFound, fmt.Sprintf("%s", err))
-		}
-
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("%s", err))
-	}
-
-	s.l.Info("User found", zap.Uint64("id", user.ID))
-	userPB := &pb.User{
-		Id:       user.ID,
-		Name:     user.Name,
-		Email:    user.Email,
-		Password: user.Password,
+		s.log(ctx).Error("GetUserByID error", zap.Error(err))
+		return nil, err
 	}
 
-	return userPB, nil
+	s.log(ctx).Info("User found", zap.Uint64("id", user.ID))
+	return newUserPB(user), nil
 }
 
 func (s *UserService) GetUserByEmail(ctx context.Context, req *pb.GetUserByEmailReq) (*pb.User, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
 	user, err := s.storage.GetUserByEmail(ctx, req.Email)
 	if err != nil {
-		s.l.Error("GetUserByEmail error", zap.Error(err))
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, status.Errorf(codes.NotFound, fmt.Sprintf("%s", err))
-		}
-
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("%s", err))
-	}
-
-	userPB := &pb.User{
-		Id:       user.ID,
-		Name:     user.Name,
-		Email:    user.Email,
-		Password: user.Password,
+		s.log(ctx).Error("GetUserByEmail error", zap.Error(err))
+		return nil, err
 	}
 
-	return userPB, nil
+	return newUserPB(user), nil
 }
 
+// UpdateUserPassword is deprecated in favour of UpdateUserPasswordByID.
 func (s *UserService) UpdateUserPassword(ctx context.Context, passDTO *pb.ChangeUserPasswordDTO) (*pb.UserUpdateResponse, error) {
+	if err := s.legacyEmailMutation(ctx, "UpdateUserPassword"); err != nil {
+		return nil, err
+	}
+
 	// convert proto struct to my struct
 	userPassDTO := dto.NewChangeUserPasswordDTO(passDTO)
 
 	// data validate
-	if err := s.validate.validateStruct(userPassDTO); err != nil {
-		s.l.Error("validateStruct error", zap.Error(err))
+	if err := s.validate.validateStruct(ctx, userPassDTO); err != nil {
+		s.log(ctx).Error("validateStruct error", zap.Error(err))
+		return nil, err
+	}
 
-		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("%s", err))
+	resp, err := s.updateUserPassword(ctx, byEmail(userPassDTO.Email), userPassDTO)
+	return resp, withCurrentProfile(err)
+}
+
+func (s *UserService) UpdateUserPasswordByID(ctx context.Context, req *pb.ChangeUserPasswordByIDReq) (*pb.UserUpdateResponse, error) {
+	userPassDTO := dto.NewChangeUserPasswordByIDDTO(req)
+
+	if err := s.validate.validateStruct(ctx, userPassDTO); err != nil {
+		s.log(ctx).Error("validateStruct error", zap.Error(err))
+		return nil, err
 	}
 
-	// get user for check password
-	user, err := s.storage.GetUserByEmail(ctx, userPassDTO.Email)
-	if err != nil {
-		s.l.Error("GetUserByEmail error", zap.Error(err))
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("%s", err))
-		}
+	if err := checkUserID(ctx, req.Id); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.updateUserPassword(ctx, byID(req.Id), userPassDTO)
+	return resp, withCurrentProfile(err)
+}
+
+// updateUserPassword checks the old password against the user returned by
+// lookup and hashes the new one, then checks the version and writes the new
+// password in a transaction. bcrypt is slow, so it runs before the
+// transaction rather than while the user is locked.
+func (s *UserService) updateUserPassword(ctx context.Context, lookup userLookup, userPassDTO *dto.ChangeUserPasswordDTO) (*pb.UserUpdateResponse, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
 
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("%s", err))
+	user, err := s.lookupOwned(storage.ReadYourWrites(ctx), s.storage, lookup)
+	if err != nil {
+		return nil, err
 	}
 
 	// compare password
-	if err = comparePasswordHash(user.Password, userPassDTO.OldPassword+salt); err != nil {
-		s.l.Error("comparePasswordHash error", zap.Error(err))
-		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("%s", err))
+	if err := comparePasswordHash(ctx, user.Password, userPassDTO.OldPassword+salt); err != nil {
+		metrics.PasswordCheckFailures.Inc()
+		s.log(ctx).Error("comparePasswordHash error", zap.Error(err))
+		return nil, errs.New(errs.ErrInvalidCredentials, errs.ReasonInvalidPassword, "old password is incorrect").WithCause(err)
 	}
 
-	// update user password
-	if err = s.storage.UpdateUserPassword(ctx, userPassDTO); err != nil {
-		s.l.Error("UpdateUserPassword error", zap.Error(err))
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("%s", err))
+	checkedHash := user.Password
+	userPassDTO.NewPassword = generatePassword(ctx, userPassDTO.NewPassword)
+
+	var version uint64
+
+	err = s.storage.WithTx(ctx, func(tx storage.IStorage) error {
+		var err error
+		if user, err = s.lookupOwned(ctx, tx, lookup); err != nil {
+			return err
+		}
+
+		if err := checkVersion(user, userPassDTO.ExpectedVersion); err != nil {
+			return err
+		}
+
+		// the password was changed after the old one was checked
+		if user.Password != checkedHash {
+			return &versionConflictError{current: user}
+		}
+
+		userPassDTO.ID = user.ID
+
+		// update user password
+		if version, err = tx.UpdateUserPassword(ctx, userPassDTO); err != nil {
+			s.log(ctx).Error("UpdateUserPassword error", zap.Error(err))
+			return s.versionConflict(ctx, tx, user.ID, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	s.webhooks.Publish(ctx, model.EventUserPasswordUpdated, model.UserEventData{ID: user.ID, Email: user.Email})
+
 	// return response
-	s.l.Info("User password updated", zap.Uint64("id", user.ID))
+	s.log(ctx).Info("User password updated", zap.Uint64("id", user.ID))
 	return &pb.UserUpdateResponse{
 		Success: true,
 		Message: "Password updated",
+		Version: version,
 	}, nil
 }
 
+// UpdateUserName is deprecated in favour of UpdateUserNameByID.
 func (s *UserService) UpdateUserName(ctx context.Context, nameDTO *pb.ChangeUserNameDTO) (*pb.UserUpdateResponse, error) {
+	if err := s.legacyEmailMutation(ctx, "UpdateUserName"); err != nil {
+		return nil, err
+	}
+
 	// convert proto struct to my struct
 	userNameUpdate := dto.NewChangeUserNameDTO(nameDTO)
 
-	user, err := s.storage.GetUserByEmail(ctx, nameDTO.Email)
-	if err != nil {
-		s.l.Error("GetUserByEmail", zap.Error(err))
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("%s", err))
-		}
+	if err := s.validate.validateStruct(ctx, userNameUpdate); err != nil {
+		s.log(ctx).Error("validateStruct error", zap.Error(err))
+		return nil, err
+	}
+
+	resp, err := s.updateUserName(ctx, byEmail(userNameUpdate.Email), userNameUpdate)
+	return resp, withCurrentProfile(err)
+}
+
+func (s *UserService) UpdateUserNameByID(ctx context.Context, req *pb.ChangeUserNameByIDReq) (*pb.UserUpdateResponse, error) {
+	userNameUpdate := dto.NewChangeUserNameByIDDTO(req)
 
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("%s", err))
+	if err := s.validate.validateStruct(ctx, userNameUpdate); err != nil {
+		s.log(ctx).Error("validateStruct error", zap.Error(err))
+		return nil, err
 	}
 
-	if err = s.storage.UpdateUserName(ctx, userNameUpdate); err != nil {
-		s.l.Error("UpdateUserName error", zap.Error(err))
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("%s", err))
+	if err := checkUserID(ctx, req.Id); err != nil {
+		return nil, err
 	}
 
-	s.l.Info("User name updated", zap.Uint64("id", user.ID))
+	resp, err := s.updateUserName(ctx, byID(req.Id), userNameUpdate)
+	return resp, withCurrentProfile(err)
+}
+
+// updateUserName checks the version against the user returned by lookup
+// and renames it in the same transaction.
+func (s *UserService) updateUserName(ctx context.Context, lookup userLookup, userNameUpdate *dto.ChangeUserNameDTO) (*pb.UserUpdateResponse, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	var (
+		user    *model.User
+		version uint64
+	)
+
+	err := s.storage.WithTx(ctx, func(tx storage.IStorage) error {
+		var err error
+		if user, err = s.lookupOwned(ctx, tx, lookup); err != nil {
+			return err
+		}
+
+		if err := checkVersion(user, userNameUpdate.ExpectedVersion); err != nil {
+			return err
+		}
+
+		userNameUpdate.ID = user.ID
+
+		if version, err = tx.UpdateUserName(ctx, userNameUpdate); err != nil {
+			s.log(ctx).Error("UpdateUserName error", zap.Error(err))
+			return s.versionConflict(ctx, tx, user.ID, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.webhooks.Publish(ctx, model.EventUserNameUpdated, model.UserEventData{ID: user.ID, Name: userNameUpdate.Name, Email: user.Email})
+
+	s.log(ctx).Info("User name updated", zap.Uint64("id", user.ID))
 	return &pb.UserUpdateResponse{
 		Success: true,
 		Message: "User name updated",
+		Version: version,
 	}, nil
 }
+
+// userLookup reads the user an update applies to, inside the update's
+// transaction.
+type userLookup func(ctx context.Context, users storage.IStorage) (*model.User, error)
+
+func byID(id uint64) userLookup {
+	return func(ctx context.Context, users storage.IStorage) (*model.User, error) {
+		return users.GetUserByID(ctx, id)
+	}
+}
+
+func byEmail(email string) userLookup {
+	return func(ctx context.Context, users storage.IStorage) (*model.User, error) {
+		return users.GetUserByEmail(ctx, email)
+	}
+}
+
+// lookupOwned runs lookup and checks that the caller may modify the user.
+func (s *UserService) lookupOwned(ctx context.Context, users storage.IStorage, lookup userLookup) (*model.User, error) {
+	user, err := lookup(ctx, users)
+	if err != nil {
+		s.log(ctx).Error("user lookup error", zap.Error(err))
+		return nil, err
+	}
+
+	if err := checkOwner(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// checkUserID rejects invalid ids and other users' ids before any lookup,
+// so that callers cannot probe other accounts.
+func checkUserID(ctx context.Context, id uint64) error {
+	if id <= 0 {
+		return errInvalidUserID
+	}
+
+	return checkOwner(ctx, id)
+}
+
+// legacyEmailMutation gates the deprecated email-keyed mutations.
+func (s *UserService) legacyEmailMutation(ctx context.Context, method string) error {
+	if !s.legacyEmailMutations {
+		return errs.New(errs.ErrUnimplemented, errs.ReasonDeprecatedEndpoint,
+			fmt.Sprintf("%s is no longer supported, use %sByID", method, method))
+	}
+
+	s.log(ctx).Warn("deprecated email-keyed mutation called", zap.String("method", method))
+	return nil
+}
+
+// checkOwner allows services and admins to modify any account and users
+// only their own.
+func checkOwner(ctx context.Context, id uint64) error {
+	identity := auth.FromContext(ctx)
+	if identity.IsService() || (identity != nil && identity.UserID == id) {
+		return nil
+	}
+
+	return errs.New(errs.ErrPermissionDenied, errs.ReasonNotOwner, "caller does not own this account")
+}
+
+// GetUsersByIDs returns the users with the given ids in one storage call.
+// Missing ids are skipped, so the result may be shorter than ids.
+func (s *UserService) GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	users, err := s.storage.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		s.log(ctx).Error("GetUsersByIDs error", zap.Error(err))
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SearchUsers returns users matching filter, ordered by id.
+func (s *UserService) SearchUsers(ctx context.Context, filter *model.UserFilter) ([]*model.User, error) {
+	if filter.Limit <= 0 || filter.Limit > _maxSearchLimit {
+		filter.Limit = _maxSearchLimit
+	}
+
+	if filter.Offset < 0 {
+		return nil, errs.New(errs.ErrInvalidArgument, errs.ReasonInvalidArgument, "invalid offset")
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	users, err := s.storage.SearchUsers(ctx, filter)
+	if err != nil {
+		s.log(ctx).Error("SearchUsers error", zap.Error(err))
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *UserService) RecordLogin(ctx context.Context, req *pb.RecordLoginReq) (*pb.UserUpdateResponse, error) {
+	if req.Id <= 0 {
+		return nil, errInvalidUserID
+	}
+
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+
+	if err := s.storage.UpdateLastLogin(ctx, req.Id); err != nil {
+		s.log(ctx).Error("UpdateLastLogin error", zap.Error(err))
+		return nil, err
+	}
+
+	return &pb.UserUpdateResponse{
+		Success: true,
+		Message: "Login recorded",
+	}, nil
+}
+
+func newUserPB(user *model.User) *pb.User {
+	return &pb.User{
+		Id:          user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Password:    user.Password,
+		Version:     user.Version,
+		CreatedAt:   timestamppb.New(user.CreatedAt),
+		UpdatedAt:   timestamppb.New(user.UpdatedAt),
+		LastLoginAt: newTimestampPB(user.LastLoginAt),
+	}
+}
+
+func newProfilePB(user *model.User) *pb.UserProfileDTO {
+	return &pb.UserProfileDTO{
+		Id:          user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Version:     user.Version,
+		CreatedAt:   timestamppb.New(user.CreatedAt),
+		UpdatedAt:   timestamppb.New(user.UpdatedAt),
+		LastLoginAt: newTimestampPB(user.LastLoginAt),
+	}
+}
+
+// newTimestampPB keeps unset times unset instead of sending the zero time.
+func newTimestampPB(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return timestamppb.New(*t)
+}
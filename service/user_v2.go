@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/model/dto"
+	pb "github.com/zhayt/user-service/proto"
+	userv2 "github.com/zhayt/user-service/proto/user/v2"
+	"github.com/zhayt/user-service/storage"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strconv"
+)
+
+// UserServiceV2 implements the resource-oriented user.v2 API on top of the
+// v1 UserService, so both share one storage layer and one set of rules.
+type UserServiceV2 struct {
+	userv2.UnimplementedUserServiceServer
+	users *UserService
+}
+
+func NewUserServiceV2(users *UserService) *UserServiceV2 {
+	return &UserServiceV2{users: users}
+}
+
+func (s *UserServiceV2) GetUser(ctx context.Context, req *userv2.GetUserRequest) (*userv2.User, error) {
+	user, err := s.users.GetUserByID(ctx, &pb.GetUserByIDReq{Id: req.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	return &userv2.User{
+		Id:            user.Id,
+		Name:          user.Name,
+		Email:         user.Email,
+		Etag:          formatEtag(user.Version),
+		CreateTime:    user.CreatedAt,
+		UpdateTime:    user.UpdatedAt,
+		LastLoginTime: user.LastLoginAt,
+	}, nil
+}
+
+func (s *UserServiceV2) CreateUser(ctx context.Context, req *userv2.CreateUserRequest) (*userv2.User, error) {
+	if req.User == nil {
+		return nil, invalidArgumentf("user is required")
+	}
+
+	profile, err := s.users.CreateUser(ctx, &pb.User{
+		Name:     req.User.Name,
+		Email:    req.User.Email,
+		Password: req.Password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &userv2.User{
+		Id:         profile.Id,
+		Name:       profile.Name,
+		Email:      profile.Email,
+		Etag:       formatEtag(profile.Version),
+		CreateTime: profile.CreatedAt,
+		UpdateTime: profile.UpdatedAt,
+	}, nil
+}
+
+// UpdateUser replaces the fields of req.User named in req.UpdateMask. Only
+// name is mutable; the password has its own ChangePassword method.
+func (s *UserServiceV2) UpdateUser(ctx context.Context, req *userv2.UpdateUserRequest) (*userv2.User, error) {
+	if req.User == nil {
+		return nil, invalidArgumentf("user is required")
+	}
+
+	paths, err := updatePaths(req)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := parseEtag(req.User.Etag)
+	if err != nil {
+		return nil, err
+	}
+
+	id := req.User.Id
+	if err := checkUserID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "name":
+			nameDTO := &dto.ChangeUserNameDTO{ID: id, Name: req.User.Name, ExpectedVersion: version}
+			if err := s.users.validate.validateStruct(ctx, nameDTO); err != nil {
+				return nil, err
+			}
+
+			if _, err := s.users.updateUserName(ctx, byID(id), nameDTO); err != nil {
+				return nil, withCurrentUserV2(err)
+			}
+		}
+	}
+
+	return s.GetUser(storage.ReadYourWrites(ctx), &userv2.GetUserRequest{Id: id})
+}
+
+func (s *UserServiceV2) ChangePassword(ctx context.Context, req *userv2.ChangePasswordRequest) (*emptypb.Empty, error) {
+	version, err := parseEtag(req.Etag)
+	if err != nil {
+		return nil, err
+	}
+
+	passDTO := &dto.ChangeUserPasswordDTO{
+		ID:                 req.Id,
+		OldPassword:        req.OldPassword,
+		NewPassword:        req.NewPassword,
+		ConfirmNewPassword: req.NewPassword,
+		ExpectedVersion:    version,
+	}
+
+	if err := s.users.validate.validateStruct(ctx, passDTO); err != nil {
+		return nil, err
+	}
+
+	if err := checkUserID(ctx, req.Id); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.users.updateUserPassword(ctx, byID(req.Id), passDTO); err != nil {
+		return nil, withCurrentUserV2(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// updatePaths returns the normalized mask paths, defaulting to every
+// populated mutable field when the mask is empty.
+func updatePaths(req *userv2.UpdateUserRequest) ([]string, error) {
+	mask := req.UpdateMask
+	if len(mask.GetPaths()) == 0 {
+		mask = &fieldmaskpb.FieldMask{}
+		if req.User.Name != "" {
+			mask.Paths = append(mask.Paths, "name")
+		}
+	}
+
+	if !mask.IsValid(req.User) {
+		return nil, invalidArgumentf("invalid update_mask %v", mask.GetPaths())
+	}
+
+	mask.Normalize()
+	for _, path := range mask.Paths {
+		if path != "name" {
+			return nil, invalidArgumentf("field %q cannot be updated", path)
+		}
+	}
+
+	if len(mask.Paths) == 0 {
+		return nil, invalidArgumentf("nothing to update")
+	}
+
+	return mask.Paths, nil
+}
+
+func newUserV2(user *model.User) *userv2.User {
+	return &userv2.User{
+		Id:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Etag:          formatEtag(user.Version),
+		CreateTime:    timestamppb.New(user.CreatedAt),
+		UpdateTime:    timestamppb.New(user.UpdatedAt),
+		LastLoginTime: newTimestampPB(user.LastLoginAt),
+	}
+}
+
+// formatEtag and parseEtag map user versions to opaque etags; an empty
+// etag means an unconditional update.
+func formatEtag(version uint64) string {
+	return strconv.FormatUint(version, 10)
+}
+
+func parseEtag(etag string) (uint64, error) {
+	if etag == "" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseUint(etag, 10, 64)
+	if err != nil || version == 0 {
+		return 0, invalidArgumentf("invalid etag")
+	}
+
+	return version, nil
+}
+
+// withCurrentUserV2 is withCurrentProfile with the current user rendered
+// as a v2 User.
+func withCurrentUserV2(err error) error {
+	var conflict *versionConflictError
+	if !errors.As(err, &conflict) {
+		return err
+	}
+
+	return errs.New(errs.ErrVersionConflict, errs.ReasonVersionConflict, conflict.Error()).
+		WithDetails(newUserV2(conflict.current))
+}
@@ -0,0 +1,103 @@
+package service_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/zhayt/user-service/auth"
+	"github.com/zhayt/user-service/errs"
+	pb "github.com/zhayt/user-service/proto"
+	userv2 "github.com/zhayt/user-service/proto/user/v2"
+	"github.com/zhayt/user-service/service"
+	"github.com/zhayt/user-service/service/servicetest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestUpdateUserMaskAndEtag(t *testing.T) {
+	const (
+		current = "current"
+		stale   = "stale"
+	)
+
+	tests := []struct {
+		name  string
+		paths []string
+		// etag is sent as is, except for current and stale
+		etag string
+		// rename sends a new name
+		rename   bool
+		wantCode codes.Code
+	}{
+		{name: "empty mask updates the populated fields", rename: true, wantCode: codes.OK},
+		{name: "empty mask with nothing populated", wantCode: codes.InvalidArgument},
+		{name: "name", paths: []string{"name"}, rename: true, wantCode: codes.OK},
+		{name: "duplicate paths", paths: []string{"name", "name"}, rename: true, wantCode: codes.OK},
+		{name: "unknown path", paths: []string{"nickname"}, rename: true, wantCode: codes.InvalidArgument},
+		{name: "immutable path", paths: []string{"name", "email"}, rename: true, wantCode: codes.InvalidArgument},
+		{name: "current etag", paths: []string{"name"}, etag: current, rename: true, wantCode: codes.OK},
+		{name: "stale etag", paths: []string{"name"}, etag: stale, rename: true, wantCode: codes.Aborted},
+		{name: "malformed etag", paths: []string{"name"}, etag: "v1", rename: true, wantCode: codes.InvalidArgument},
+		{name: "zero etag", paths: []string{"name"}, etag: "0", rename: true, wantCode: codes.InvalidArgument},
+		{name: "negative etag", paths: []string{"name"}, etag: "-1", rename: true, wantCode: codes.InvalidArgument},
+	}
+
+	f := servicetest.New(t, nil)
+	users := service.NewUserServiceV2(f.Users)
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{Subject: "forum", Role: auth.RoleService})
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "user" + string(rune('a'+i))
+			created, err := f.Users.CreateUser(ctx, &pb.User{Name: name, Email: name + "@example.com", Password: "Secret123!"})
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			newName := ""
+			if tt.rename {
+				newName = "renamed" + string(rune('a'+i))
+			}
+
+			etag := tt.etag
+			switch etag {
+			case current:
+				etag = strconv.FormatUint(created.Version, 10)
+			case stale:
+				if _, err := users.UpdateUser(ctx, &userv2.UpdateUserRequest{User: &userv2.User{Id: created.Id, Name: name + "x"}}); err != nil {
+					t.Fatalf("UpdateUser: %v", err)
+				}
+				etag = strconv.FormatUint(created.Version, 10)
+			}
+
+			req := &userv2.UpdateUserRequest{User: &userv2.User{Id: created.Id, Name: newName, Etag: etag}}
+			if tt.paths != nil {
+				req.UpdateMask = &fieldmaskpb.FieldMask{Paths: tt.paths}
+			}
+
+			got, err := users.UpdateUser(ctx, req)
+			if code := errs.Status(err).Code(); code != tt.wantCode {
+				t.Fatalf("UpdateUser() code = %v, want %v (%v)", code, tt.wantCode, err)
+			}
+
+			if tt.wantCode == codes.Aborted && !hasCurrentUser(errs.Status(err).Details(), name+"x") {
+				t.Errorf("conflict details = %v, want the current user", errs.Status(err).Details())
+			}
+
+			if tt.wantCode == codes.OK && (got.Name != newName || got.Etag == etag) {
+				t.Errorf("UpdateUser() = %v, want name %q and a new etag", got, newName)
+			}
+		})
+	}
+}
+
+func hasCurrentUser(details []interface{}, name string) bool {
+	for _, detail := range details {
+		if user, ok := detail.(*userv2.User); ok && user.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
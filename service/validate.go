@@ -1,33 +1,169 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/kk"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	rutranslations "github.com/go-playground/validator/v10/translations/ru"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/metrics"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/metadata"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
 )
 
 const salt = "qwerty"
 
+var tracer = otel.Tracer("github.com/zhayt/user-service/service")
+
+// _defaultLocale is used when the caller asks for no supported locale.
+const _defaultLocale = "en"
+
+// localeHeader is the metadata key the validation message locale is taken
+// from, in Accept-Language format.
+const localeHeader = "accept-language"
+
 type ValidateService struct {
 	validate *validator.Validate
+	uni      *ut.UniversalTranslator
 }
 
-func NewValidateService() *ValidateService {
-	return &ValidateService{validate: validator.New()}
+func NewValidateService() (*ValidateService, error) {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(fieldName)
+
+	uni := ut.New(en.New(), ru.New(), kk.New())
+
+	registrations := map[string]func(*validator.Validate, ut.Translator) error{
+		"en": entranslations.RegisterDefaultTranslations,
+		"ru": rutranslations.RegisterDefaultTranslations,
+		"kk": func(*validator.Validate, ut.Translator) error { return nil },
+	}
+
+	for locale, registerDefaults := range registrations {
+		trans, _ := uni.GetTranslator(locale)
+		if err := registerDefaults(validate, trans); err != nil {
+			return nil, fmt.Errorf("cannot register %s translations: %w", locale, err)
+		}
+
+		if err := registerExtraTranslations(validate, trans); err != nil {
+			return nil, fmt.Errorf("cannot register extra %s translations: %w", locale, err)
+		}
+	}
+
+	return &ValidateService{validate: validate, uni: uni}, nil
 }
 
-func (s *ValidateService) validateStruct(data interface{}) error {
-	return s.validate.Struct(data)
+// validateStruct returns an errs.ErrInvalidArgument carrying a
+// google.rpc.BadRequest with one violation per field, translated to the
+// caller's locale. The ErrorInfo metadata maps each field to the failed
+// validation tag, which clients can rely on as a stable code.
+func (s *ValidateService) validateStruct(ctx context.Context, data interface{}) error {
+	err := s.validate.Struct(data)
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	trans := s.translator(ctx)
+	fallback, _ := s.uni.GetTranslator(_defaultLocale)
+
+	validationErr := errs.New(errs.ErrInvalidArgument, errs.ReasonValidationFailed, "")
+	badRequest := &errdetails.BadRequest{}
+	messages := make([]string, 0, len(fieldErrs))
+	localized := make([]string, 0, len(fieldErrs))
+
+	for _, fe := range fieldErrs {
+		description := fe.Translate(trans)
+
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field(),
+			Description: description,
+		})
+		validationErr.WithMetadata(fe.Field(), fe.Tag())
+		messages = append(messages, fe.Translate(fallback))
+		localized = append(localized, description)
+	}
+
+	validationErr.Message = strings.Join(messages, "; ")
+	return validationErr.WithDetails(badRequest, &errdetails.LocalizedMessage{
+		Locale:  trans.Locale(),
+		Message: strings.Join(localized, "; "),
+	})
+}
+
+// translator picks the first supported language from the caller's
+// accept-language metadata, ignoring regions and weights.
+func (s *ValidateService) translator(ctx context.Context) ut.Translator {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var locales []string
+	for _, header := range md.Get(localeHeader) {
+		for _, tag := range strings.Split(header, ",") {
+			tag, _, _ = strings.Cut(strings.TrimSpace(tag), ";")
+			tag, _, _ = strings.Cut(tag, "-")
+			locales = append(locales, strings.ToLower(tag))
+		}
+	}
+
+	if trans, found := s.uni.FindTranslator(locales...); found {
+		return trans
+	}
+
+	trans, _ := s.uni.GetTranslator(_defaultLocale)
+	return trans
 }
 
-func (s *ValidateService) validateVariable(data interface{}, tag string) error {
-	return s.validate.Var(data, tag)
+// fieldName names fields in violations after their json tag, or the
+// snake_case Go name, to match the proto field names clients send.
+func fieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+
+	var b strings.Builder
+	for i, r := range field.Name {
+		if unicode.IsUpper(r) {
+			if i > 0 && !unicode.IsUpper(rune(field.Name[i-1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
 }
 
-func generatePassword(password string) string {
+func generatePassword(ctx context.Context, password string) string {
+	_, span := tracer.Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+	defer observeHash("hash", time.Now())
+
 	bytes, _ := bcrypt.GenerateFromPassword([]byte(password+salt), bcrypt.DefaultCost)
 	return string(bytes)
 }
 
-func comparePasswordHash(hash string, password string) error {
+func comparePasswordHash(ctx context.Context, hash string, password string) error {
+	_, span := tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
+	defer observeHash("compare", time.Now())
+
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
+
+func observeHash(operation string, start time.Time) {
+	metrics.PasswordHashDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,79 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zhayt/user-service/errs"
+	pb "github.com/zhayt/user-service/proto"
+	"github.com/zhayt/user-service/service/servicetest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValidationErrorsAreTranslated(t *testing.T) {
+	const (
+		en = "name must be at least 3 characters in length"
+		ru = "name должен содержать минимум 3 символа"
+		kk = "name ұзындығы кемінде 3 таңба болуы керек"
+	)
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		wantLocale     string
+		want           string
+	}{
+		{name: "no header", wantLocale: "en", want: en},
+		{name: "en", acceptLanguage: "en-US", wantLocale: "en", want: en},
+		{name: "ru", acceptLanguage: "ru-RU,ru;q=0.9", wantLocale: "ru", want: ru},
+		{name: "kk", acceptLanguage: "kk", wantLocale: "kk", want: kk},
+		{name: "first supported", acceptLanguage: "fr-FR, kk;q=0.8, ru;q=0.5", wantLocale: "kk", want: kk},
+		{name: "unknown falls back to en", acceptLanguage: "fr, de", wantLocale: "en", want: en},
+	}
+
+	f := servicetest.New(t, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.acceptLanguage != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("accept-language", tt.acceptLanguage))
+			}
+
+			_, err := f.Users.CreateUser(ctx, &pb.User{Name: "ab", Email: "ab@example.com", Password: "Secret123!"})
+
+			st := errs.Status(err)
+			if st.Code() != codes.InvalidArgument {
+				t.Fatalf("CreateUser() = %v, want InvalidArgument", err)
+			}
+
+			// the status message stays in English for logs
+			if st.Message() != en {
+				t.Errorf("message = %q, want %q", st.Message(), en)
+			}
+
+			var (
+				violations []*errdetails.BadRequest_FieldViolation
+				localized  *errdetails.LocalizedMessage
+			)
+			for _, detail := range st.Details() {
+				switch d := detail.(type) {
+				case *errdetails.BadRequest:
+					violations = d.FieldViolations
+				case *errdetails.LocalizedMessage:
+					localized = d
+				}
+			}
+
+			if len(violations) != 1 || violations[0].Field != "name" || violations[0].Description != tt.want {
+				t.Errorf("field violations = %v, want name: %q", violations, tt.want)
+			}
+
+			if localized.GetLocale() != tt.wantLocale || localized.GetMessage() != tt.want {
+				t.Errorf("localized message = %v, want %s: %q", localized, tt.wantLocale, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+	pb "github.com/zhayt/user-service/proto"
+	"go.uber.org/zap"
+)
+
+func (s *UserService) CreateWebhook(ctx context.Context, webhookPB *pb.Webhook) (*pb.Webhook, error) {
+	webhook := model.NewWebhook(webhookPB)
+
+	// generate a signing secret when the subscriber did not bring one
+	if webhook.Secret == "" {
+		webhook.Secret = generateWebhookSecret()
+	}
+
+	if err := s.validate.validateStruct(ctx, webhook); err != nil {
+		s.log(ctx).Error("validateStruct error", zap.Error(err))
+		return nil, err
+	}
+
+	webhookID, err := s.storage.CreateWebhook(ctx, webhook)
+	if err != nil {
+		s.log(ctx).Error("CreateWebhook error", zap.Error(err))
+		return nil, err
+	}
+
+	s.log(ctx).Info("Webhook created", zap.Uint64("id", webhookID))
+	return &pb.Webhook{
+		Id:     webhookID,
+		Url:    webhook.URL,
+		Secret: webhook.Secret,
+		Events: webhook.Events,
+	}, nil
+}
+
+func (s *UserService) ListWebhooks(ctx context.Context, _ *pb.ListWebhooksReq) (*pb.WebhookList, error) {
+	webhooks, err := s.storage.GetWebhooks(ctx)
+	if err != nil {
+		s.log(ctx).Error("GetWebhooks error", zap.Error(err))
+		return nil, err
+	}
+
+	// secrets are only returned once, on creation
+	list := &pb.WebhookList{Webhooks: make([]*pb.Webhook, 0, len(webhooks))}
+	for _, webhook := range webhooks {
+		list.Webhooks = append(list.Webhooks, &pb.Webhook{
+			Id:     webhook.ID,
+			Url:    webhook.URL,
+			Events: webhook.Events,
+		})
+	}
+
+	return list, nil
+}
+
+func (s *UserService) DeleteWebhook(ctx context.Context, req *pb.WebhookIDReq) (*pb.UserUpdateResponse, error) {
+	if req.Id <= 0 {
+		return nil, errs.New(errs.ErrInvalidArgument, errs.ReasonInvalidArgument, "invalid webhook id")
+	}
+
+	if _, err := s.storage.GetWebhookByID(ctx, req.Id); err != nil {
+		s.log(ctx).Error("GetWebhookByID error", zap.Error(err))
+		return nil, err
+	}
+
+	if err := s.storage.DeleteWebhook(ctx, req.Id); err != nil {
+		s.log(ctx).Error("DeleteWebhook error", zap.Error(err))
+		return nil, err
+	}
+
+	s.log(ctx).Info("Webhook deleted", zap.Uint64("id", req.Id))
+	return &pb.UserUpdateResponse{
+		Success: true,
+		Message: "Webhook deleted",
+	}, nil
+}
+
+func (s *UserService) ListWebhookDeadLetters(ctx context.Context, req *pb.ListWebhookDeadLettersReq) (*pb.WebhookDeadLetterList, error) {
+	letters, err := s.storage.GetDeadLetters(ctx, req.WebhookId)
+	if err != nil {
+		s.log(ctx).Error("GetDeadLetters error", zap.Error(err))
+		return nil, err
+	}
+
+	list := &pb.WebhookDeadLetterList{DeadLetters: make([]*pb.WebhookDeadLetter, 0, len(letters))}
+	for _, letter := range letters {
+		list.DeadLetters = append(list.DeadLetters, &pb.WebhookDeadLetter{
+			Id:        letter.ID,
+			WebhookId: letter.WebhookID,
+			EventType: letter.EventType,
+			Payload:   letter.Payload,
+			Attempts:  letter.Attempts,
+			LastError: letter.LastError,
+		})
+	}
+
+	return list, nil
+}
+
+func (s *UserService) ReplayWebhookDeadLetters(ctx context.Context, req *pb.ReplayWebhookDeadLettersReq) (*pb.ReplayWebhookDeadLettersResponse, error) {
+	replayed, err := s.webhooks.Replay(ctx, req.Ids)
+	if err != nil {
+		s.log(ctx).Error("Replay error", zap.Error(err))
+		return nil, err
+	}
+
+	s.log(ctx).Info("Webhook dead letters replayed", zap.Int("count", replayed))
+	return &pb.ReplayWebhookDeadLettersResponse{Replayed: uint32(replayed)}, nil
+}
+
+func generateWebhookSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
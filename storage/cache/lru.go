@@ -0,0 +1,116 @@
+// Package cache holds the in-process backend of the storage user cache.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zhayt/user-service/model"
+)
+
+// LRU keeps up to size users in memory, evicting the least recently used
+// one when full. Entries expire after the ttl they were set with.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[uint64]*list.Element
+	now     func() time.Time
+}
+
+type entry struct {
+	id        uint64
+	user      *model.User
+	expiresAt time.Time
+}
+
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[uint64]*list.Element, size),
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached user, nil for a cached not-found, and whether the
+// id was cached at all.
+func (c *LRU) Get(_ context.Context, id uint64) (*model.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if c.now().After(e.expiresAt) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return copyUser(e.user), true
+}
+
+// Set caches user, or a not-found when user is nil, for ttl.
+func (c *LRU) Set(_ context.Context, id uint64, user *model.User, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &entry{id: id, user: copyUser(user), expiresAt: c.now().Add(ttl)}
+
+	if elem, ok := c.entries[id]; ok {
+		elem.Value = e
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[id] = c.order.PushFront(e)
+
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU) Delete(_ context.Context, ids ...uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range ids {
+		if elem, ok := c.entries[id]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// Len returns the number of cached entries, expired ones included.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*entry).id)
+}
+
+// copyUser keeps callers from mutating cached users.
+func copyUser(user *model.User) *model.User {
+	if user == nil {
+		return nil
+	}
+
+	c := *user
+	if user.LastLoginAt != nil {
+		lastLogin := *user.LastLoginAt
+		c.LastLoginAt = &lastLogin
+	}
+
+	return &c
+}
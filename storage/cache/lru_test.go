@@ -0,0 +1,37 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/storage/cache"
+)
+
+func TestLRUCopiesUsers(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(10)
+
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	lastLogin := want
+	user := &model.User{ID: 1, Name: "alice", LastLoginAt: &lastLogin}
+	c.Set(ctx, 1, user, time.Minute)
+
+	// the caller keeps mutating what it passed to Set
+	user.Name = "mallory"
+	*user.LastLoginAt = time.Time{}
+
+	got, ok := c.Get(ctx, 1)
+	if !ok || got.Name != "alice" || !got.LastLoginAt.Equal(want) {
+		t.Fatalf("Get after mutating the stored user = %+v", got)
+	}
+
+	// and mutates what Get returned
+	*got.LastLoginAt = time.Time{}
+
+	got, _ = c.Get(ctx, 1)
+	if !got.LastLoginAt.Equal(want) {
+		t.Errorf("Get after mutating a returned user: last login %v, want %v", got.LastLoginAt, want)
+	}
+}
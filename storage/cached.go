@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/metrics"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/model/dto"
+	"github.com/zhayt/user-service/storage/routing"
+)
+
+// CacheBackend stores users for WithCache by id; a nil user records that
+// the id does not exist. cache.LRU is the in-process backend; a shared one
+// such as Redis implements the same methods and encodes users itself.
+type CacheBackend interface {
+	Get(ctx context.Context, id uint64) (*model.User, bool)
+	Set(ctx context.Context, id uint64, user *model.User, ttl time.Duration)
+	Delete(ctx context.Context, ids ...uint64)
+}
+
+// WithCache returns s with GetUserByID and GetUsersByIDs served from
+// backend for cfg.CacheTTL, and not-found results for cfg.CacheNegativeTTL.
+// Every mutation drops the user's entry once it is written, or once its
+// transaction ends. With an in-process backend, other instances keep
+// serving their entry until it expires.
+func (s *Storage) WithCache(backend CacheBackend, cfg *config.Config) *Storage {
+	c := &cachedUsers{
+		IStorage:    s.IStorage,
+		backend:     backend,
+		ttl:         cfg.CacheTTL,
+		negativeTTL: cfg.CacheNegativeTTL,
+	}
+
+	return &Storage{c, s.IWebhookStorage, func(ctx context.Context, fn func(tx IStorage) error) error {
+		tx := &txUsers{}
+		defer func() { c.invalidate(ctx, tx.touched...) }()
+
+		return s.withTx(ctx, func(inner IStorage) error {
+			tx.IStorage = inner
+			return fn(tx)
+		})
+	}}
+}
+
+// cachedUsers is the caching decorator. Reads asked to ReadYourWrites skip
+// the cache along with the replicas, and misses are read from the primary
+// too: a lagging replica would put a row back that a mutation has just
+// invalidated. Mutations added to IStorage must invalidate here and in
+// txUsers.
+type cachedUsers struct {
+	IStorage
+	backend     CacheBackend
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	// epoch counts invalidations, so that a read racing with a mutation
+	// does not put what it read back into the cache
+	mu    sync.Mutex
+	epoch uint64
+}
+
+func (c *cachedUsers) GetUserByID(ctx context.Context, id uint64) (*model.User, error) {
+	if routing.UsesPrimary(ctx) {
+		return c.IStorage.GetUserByID(ctx, id)
+	}
+
+	if user, ok := c.get(ctx, id); ok {
+		if user == nil {
+			return nil, errs.UserNotFound()
+		}
+
+		return user, nil
+	}
+
+	epoch := c.currentEpoch()
+
+	user, err := c.IStorage.GetUserByID(ReadYourWrites(ctx), id)
+	if err == nil {
+		c.fill(ctx, epoch, map[uint64]*model.User{id: user})
+	} else if errors.Is(err, errs.ErrNotFound) {
+		c.fill(ctx, epoch, map[uint64]*model.User{id: nil})
+	}
+
+	return user, err
+}
+
+func (c *cachedUsers) GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error) {
+	if routing.UsesPrimary(ctx) {
+		return c.IStorage.GetUsersByIDs(ctx, ids)
+	}
+
+	var (
+		users   []*model.User
+		missing []uint64
+	)
+
+	seen := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		user, ok := c.get(ctx, id)
+		if !ok {
+			missing = append(missing, id)
+		} else if user != nil {
+			users = append(users, user)
+		}
+	}
+
+	if len(missing) == 0 {
+		return users, nil
+	}
+
+	epoch := c.currentEpoch()
+
+	found, err := c.IStorage.GetUsersByIDs(ReadYourWrites(ctx), missing)
+	if err != nil {
+		return nil, err
+	}
+
+	fills := make(map[uint64]*model.User, len(missing))
+	for _, id := range missing {
+		fills[id] = nil
+	}
+	for _, user := range found {
+		fills[user.ID] = user
+	}
+	c.fill(ctx, epoch, fills)
+
+	return append(users, found...), nil
+}
+
+func (c *cachedUsers) CreateUser(ctx context.Context, user *model.User) (uint64, error) {
+	id, err := c.IStorage.CreateUser(ctx, user)
+	if err == nil {
+		// drops a cached not-found for the new id
+		c.invalidate(ctx, id)
+	}
+
+	return id, err
+}
+
+func (c *cachedUsers) UpdateLastLogin(ctx context.Context, id uint64) error {
+	defer c.invalidate(ctx, id)
+	return c.IStorage.UpdateLastLogin(ctx, id)
+}
+
+func (c *cachedUsers) UpdateUserPassword(ctx context.Context, user *dto.ChangeUserPasswordDTO) (uint64, error) {
+	defer c.invalidate(ctx, user.ID)
+	return c.IStorage.UpdateUserPassword(ctx, user)
+}
+
+func (c *cachedUsers) UpdateUserName(ctx context.Context, user *dto.ChangeUserNameDTO) (uint64, error) {
+	defer c.invalidate(ctx, user.ID)
+	return c.IStorage.UpdateUserName(ctx, user)
+}
+
+func (c *cachedUsers) get(ctx context.Context, id uint64) (*model.User, bool) {
+	user, ok := c.backend.Get(ctx, id)
+
+	switch {
+	case !ok:
+		metrics.CacheRequests.WithLabelValues("miss").Inc()
+	case user == nil:
+		metrics.CacheRequests.WithLabelValues("negative_hit").Inc()
+	default:
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
+	}
+
+	return user, ok
+}
+
+func (c *cachedUsers) currentEpoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.epoch
+}
+
+// fill caches users read since epoch, unless a mutation happened since.
+func (c *cachedUsers) fill(ctx context.Context, epoch uint64, users map[uint64]*model.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epoch != epoch {
+		return
+	}
+
+	for id, user := range users {
+		ttl := c.ttl
+		if user == nil {
+			ttl = c.negativeTTL
+		}
+
+		c.backend.Set(ctx, id, user, ttl)
+	}
+}
+
+func (c *cachedUsers) invalidate(ctx context.Context, ids ...uint64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	c.backend.Delete(ctx, ids...)
+}
+
+// txUsers is the storage passed to WithTx callbacks of a cached Storage.
+// Reads go to the transaction, and the users it writes are invalidated
+// when it ends.
+type txUsers struct {
+	IStorage
+	touched []uint64
+}
+
+func (t *txUsers) CreateUser(ctx context.Context, user *model.User) (uint64, error) {
+	id, err := t.IStorage.CreateUser(ctx, user)
+	if err == nil {
+		t.touched = append(t.touched, id)
+	}
+
+	return id, err
+}
+
+func (t *txUsers) UpdateLastLogin(ctx context.Context, id uint64) error {
+	t.touched = append(t.touched, id)
+	return t.IStorage.UpdateLastLogin(ctx, id)
+}
+
+func (t *txUsers) UpdateUserPassword(ctx context.Context, user *dto.ChangeUserPasswordDTO) (uint64, error) {
+	t.touched = append(t.touched, user.ID)
+	return t.IStorage.UpdateUserPassword(ctx, user)
+}
+
+func (t *txUsers) UpdateUserName(ctx context.Context, user *dto.ChangeUserNameDTO) (uint64, error) {
+	t.touched = append(t.touched, user.ID)
+	return t.IStorage.UpdateUserName(ctx, user)
+}
@@ -0,0 +1,67 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/storage"
+	"github.com/zhayt/user-service/storage/cache"
+	"github.com/zhayt/user-service/storage/routing"
+	"github.com/zhayt/user-service/storage/storagetest"
+	"go.uber.org/zap"
+)
+
+var _cacheConfig = &config.Config{CacheTTL: time.Minute, CacheNegativeTTL: time.Minute}
+
+func TestCachedStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) *storage.Storage {
+		return storage.NewMemoryStorage(zap.NewNop()).WithCache(cache.NewLRU(100), _cacheConfig)
+	})
+}
+
+// replicaUsers records whether each lookup was sent to the primary.
+type replicaUsers struct {
+	storage.IStorage
+	primary []bool
+}
+
+func (r *replicaUsers) GetUserByID(ctx context.Context, id uint64) (*model.User, error) {
+	r.primary = append(r.primary, routing.UsesPrimary(ctx))
+	return r.IStorage.GetUserByID(ctx, id)
+}
+
+func (r *replicaUsers) GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error) {
+	r.primary = append(r.primary, routing.UsesPrimary(ctx))
+	return r.IStorage.GetUsersByIDs(ctx, ids)
+}
+
+func TestCacheMissesReadFromPrimary(t *testing.T) {
+	ctx := context.Background()
+
+	mem := storage.NewMemoryStorage(zap.NewNop())
+	id, err := mem.CreateUser(ctx, &model.User{Name: "alice", Email: "alice@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	users := &replicaUsers{IStorage: mem.IStorage}
+	cached := (&storage.Storage{IStorage: users}).WithCache(cache.NewLRU(100), _cacheConfig)
+
+	if _, err := cached.GetUserByID(ctx, id); err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if _, err := cached.GetUsersByIDs(ctx, []uint64{id, id + 1}); err != nil {
+		t.Fatalf("GetUsersByIDs: %v", err)
+	}
+	if _, err := cached.GetUserByID(ctx, id); err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+
+	// the second lookup only misses id+1, the third is a hit
+	if len(users.primary) != 2 || !users.primary[0] || !users.primary[1] {
+		t.Errorf("lookups reached storage with primary = %v, want two lookups on the primary", users.primary)
+	}
+}
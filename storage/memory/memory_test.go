@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/zhayt/user-service/storage"
+	"github.com/zhayt/user-service/storage/storagetest"
+	"go.uber.org/zap"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) *storage.Storage {
+		return storage.NewMemoryStorage(zap.NewNop())
+	})
+}
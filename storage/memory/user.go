@@ -0,0 +1,266 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/model/dto"
+)
+
+// UserStorage keeps users in memory with the same semantics as
+// postgre.UserStorage: case-insensitive unique emails and names, versioned
+// updates and errs kinds for missing users and conflicts.
+type UserStorage struct {
+	mu *sync.RWMutex
+	*userTable
+	// inTx is set on the storage passed to WithTx callbacks, which already
+	// hold mu
+	inTx bool
+}
+
+type userTable struct {
+	byID   map[uint64]*model.User
+	nextID uint64
+}
+
+func NewUserStorage() *UserStorage {
+	return &UserStorage{mu: &sync.RWMutex{}, userTable: &userTable{byID: make(map[uint64]*model.User)}}
+}
+
+// WithTx runs fn holding the write lock and restores the previous state
+// when it fails, so fn sees no concurrent changes and its own apply all or
+// nothing.
+func (r *UserStorage) WithTx(_ context.Context, fn func(tx *UserStorage) error) error {
+	defer r.lock()()
+
+	snapshot := userTable{byID: make(map[uint64]*model.User, len(r.byID)), nextID: r.nextID}
+	for id, user := range r.byID {
+		snapshot.byID[id] = copyUser(user)
+	}
+
+	if err := fn(&UserStorage{mu: r.mu, userTable: r.userTable, inTx: true}); err != nil {
+		*r.userTable = snapshot
+		return err
+	}
+
+	return nil
+}
+
+func (r *UserStorage) lock() func() {
+	if r.inTx {
+		return func() {}
+	}
+
+	r.mu.Lock()
+	return r.mu.Unlock
+}
+
+func (r *UserStorage) rlock() func() {
+	if r.inTx {
+		return func() {}
+	}
+
+	r.mu.RLock()
+	return r.mu.RUnlock
+}
+
+func (r *UserStorage) CreateUser(_ context.Context, user *model.User) (uint64, error) {
+	defer r.lock()()
+
+	if err := r.checkUnique(0, user.Email, user.Name); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+
+	r.nextID++
+	user.ID = r.nextID
+	user.Version = 1
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	stored := *user
+	r.byID[stored.ID] = &stored
+
+	return user.ID, nil
+}
+
+func (r *UserStorage) GetUserByID(_ context.Context, id uint64) (*model.User, error) {
+	defer r.rlock()()
+
+	user, ok := r.byID[id]
+	if !ok {
+		return nil, errs.UserNotFound()
+	}
+
+	return copyUser(user), nil
+}
+
+func (r *UserStorage) GetUserByEmail(_ context.Context, email string) (*model.User, error) {
+	defer r.rlock()()
+
+	for _, user := range r.byID {
+		if strings.EqualFold(user.Email, email) {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, errs.UserNotFound()
+}
+
+func (r *UserStorage) GetUsersByIDs(_ context.Context, ids []uint64) ([]*model.User, error) {
+	defer r.rlock()()
+
+	var users []*model.User
+	seen := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		if user, ok := r.byID[id]; ok && !seen[id] {
+			seen[id] = true
+			users = append(users, copyUser(user))
+		}
+	}
+
+	return users, nil
+}
+
+func (r *UserStorage) SearchUsers(_ context.Context, filter *model.UserFilter) ([]*model.User, error) {
+	defer r.rlock()()
+
+	query := strings.ToLower(filter.Query)
+
+	var users []*model.User
+	for _, user := range r.byID {
+		if strings.Contains(strings.ToLower(user.Name), query) && matches(user, filter) {
+			users = append(users, copyUser(user))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	if filter.Offset >= len(users) {
+		return nil, nil
+	}
+
+	users = users[filter.Offset:]
+	if len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+
+	return users, nil
+}
+
+func (r *UserStorage) UpdateLastLogin(_ context.Context, id uint64) error {
+	defer r.lock()()
+
+	user, ok := r.byID[id]
+	if !ok {
+		return errs.UserNotFound()
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+
+	return nil
+}
+
+func (r *UserStorage) UpdateUserPassword(_ context.Context, update *dto.ChangeUserPasswordDTO) (uint64, error) {
+	defer r.lock()()
+
+	user, err := r.versioned(update.ID, update.ExpectedVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	user.Password = update.NewPassword
+	return bump(user), nil
+}
+
+func (r *UserStorage) UpdateUserName(_ context.Context, update *dto.ChangeUserNameDTO) (uint64, error) {
+	defer r.lock()()
+
+	user, err := r.versioned(update.ID, update.ExpectedVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.checkUnique(user.ID, "", update.Name); err != nil {
+		return 0, err
+	}
+
+	user.Name = update.Name
+	return bump(user), nil
+}
+
+// versioned returns the stored user for a conditional update. Like the
+// postgres UPDATE ... WHERE version = $n, a missing user is reported as a
+// version conflict.
+func (r *UserStorage) versioned(id, expected uint64) (*model.User, error) {
+	user, ok := r.byID[id]
+	if !ok || (expected != 0 && user.Version != expected) {
+		return nil, errs.UserVersionConflict()
+	}
+
+	return user, nil
+}
+
+// checkUnique mirrors the lower(email) and lower(name) unique indexes;
+// empty values are not checked. The user with id self is ignored.
+func (r *UserStorage) checkUnique(self uint64, email, name string) error {
+	for id, user := range r.byID {
+		if id == self {
+			continue
+		}
+
+		if email != "" && strings.EqualFold(user.Email, email) {
+			return errs.UserExists("email")
+		}
+
+		if name != "" && strings.EqualFold(user.Name, name) {
+			return errs.UserExists("name")
+		}
+	}
+
+	return nil
+}
+
+func matches(user *model.User, filter *model.UserFilter) bool {
+	if filter.CreatedAfter != nil && user.CreatedAt.Before(*filter.CreatedAfter) {
+		return false
+	}
+
+	if filter.CreatedBefore != nil && !user.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+
+	if filter.LastLoginAfter != nil && (user.LastLoginAt == nil || user.LastLoginAt.Before(*filter.LastLoginAfter)) {
+		return false
+	}
+
+	if filter.LastLoginBefore != nil && user.LastLoginAt != nil && !user.LastLoginAt.Before(*filter.LastLoginBefore) {
+		return false
+	}
+
+	return true
+}
+
+func bump(user *model.User) uint64 {
+	user.Version++
+	user.UpdatedAt = time.Now()
+	return user.Version
+}
+
+// copyUser keeps callers from mutating stored users.
+func copyUser(user *model.User) *model.User {
+	c := *user
+	if user.LastLoginAt != nil {
+		lastLogin := *user.LastLoginAt
+		c.LastLoginAt = &lastLogin
+	}
+
+	return &c
+}
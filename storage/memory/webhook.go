@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+)
+
+// WebhookStorage keeps webhooks and their dead letters in memory. Deleting
+// a webhook deletes its dead letters, like the postgres foreign key.
+type WebhookStorage struct {
+	mu           sync.RWMutex
+	webhooks     map[uint64]*model.Webhook
+	letters      map[uint64]*model.WebhookDeadLetter
+	nextWebhook  uint64
+	nextLetterID uint64
+}
+
+func NewWebhookStorage() *WebhookStorage {
+	return &WebhookStorage{
+		webhooks: make(map[uint64]*model.Webhook),
+		letters:  make(map[uint64]*model.WebhookDeadLetter),
+	}
+}
+
+func (r *WebhookStorage) CreateWebhook(_ context.Context, webhook *model.Webhook) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextWebhook++
+	stored := copyWebhook(webhook)
+	stored.ID = r.nextWebhook
+	r.webhooks[stored.ID] = stored
+
+	return stored.ID, nil
+}
+
+func (r *WebhookStorage) GetWebhooks(_ context.Context) ([]*model.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := make([]*model.Webhook, 0, len(r.webhooks))
+	for _, webhook := range r.webhooks {
+		webhooks = append(webhooks, copyWebhook(webhook))
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (r *WebhookStorage) GetWebhookByID(_ context.Context, id uint64) (*model.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, errs.WebhookNotFound()
+	}
+
+	return copyWebhook(webhook), nil
+}
+
+func (r *WebhookStorage) DeleteWebhook(_ context.Context, id uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.webhooks, id)
+	for letterID, letter := range r.letters {
+		if letter.WebhookID == id {
+			delete(r.letters, letterID)
+		}
+	}
+
+	return nil
+}
+
+func (r *WebhookStorage) CreateDeadLetter(_ context.Context, letter *model.WebhookDeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[letter.WebhookID]; !ok {
+		return errs.WebhookNotFound()
+	}
+
+	r.nextLetterID++
+	stored := *letter
+	stored.ID = r.nextLetterID
+	r.letters[stored.ID] = &stored
+
+	return nil
+}
+
+func (r *WebhookStorage) GetDeadLetters(_ context.Context, webhookID uint64) ([]*model.WebhookDeadLetter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var letters []*model.WebhookDeadLetter
+	for _, letter := range r.letters {
+		if webhookID == 0 || letter.WebhookID == webhookID {
+			c := *letter
+			letters = append(letters, &c)
+		}
+	}
+
+	sortLetters(letters)
+	return letters, nil
+}
+
+func (r *WebhookStorage) GetDeadLettersByIDs(_ context.Context, ids []uint64) ([]*model.WebhookDeadLetter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var letters []*model.WebhookDeadLetter
+	seen := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		if letter, ok := r.letters[id]; ok && !seen[id] {
+			seen[id] = true
+			c := *letter
+			letters = append(letters, &c)
+		}
+	}
+
+	sortLetters(letters)
+	return letters, nil
+}
+
+func (r *WebhookStorage) DeleteDeadLetter(_ context.Context, id uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.letters, id)
+	return nil
+}
+
+func sortLetters(letters []*model.WebhookDeadLetter) {
+	sort.Slice(letters, func(i, j int) bool { return letters[i].ID < letters[j].ID })
+}
+
+func copyWebhook(webhook *model.Webhook) *model.Webhook {
+	c := *webhook
+	c.Events = append([]string(nil), webhook.Events...)
+	return &c
+}
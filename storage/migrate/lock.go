@@ -0,0 +1,21 @@
+package migrate
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AdvisoryLock is a postgres session advisory lock under key, held while
+// migrating so that replicas starting together apply each migration once.
+type AdvisoryLock int64
+
+func (k AdvisoryLock) Lock(ctx context.Context, conn *sqlx.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, int64(k))
+	return err
+}
+
+func (k AdvisoryLock) Unlock(ctx context.Context, conn *sqlx.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, int64(k))
+	return err
+}
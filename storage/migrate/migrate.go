@@ -0,0 +1,281 @@
+// Package migrate applies the SQL migrations embedded in the storage
+// backends and records them in the schema_migrations table.
+//
+// Migrations are files named NNNNNN_name.up.sql with an optional matching
+// .down.sql. Each one runs in its own transaction together with its
+// schema_migrations row.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// ErrNoDownScript is returned when rolling back a migration without a
+// .down.sql file.
+var ErrNoDownScript = errors.New("migration has no down script")
+
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a known migration and when it was applied, nil if pending.
+type Status struct {
+	Version   uint64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Locker serialises migrators of several replicas. Lock and Unlock run on
+// the connection the migrations are applied on.
+type Locker interface {
+	Lock(ctx context.Context, conn *sqlx.Conn) error
+	Unlock(ctx context.Context, conn *sqlx.Conn) error
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+	locker     Locker
+	l          *zap.Logger
+}
+
+// NewMigrator reads the migrations in the root of fsys. A nil locker is
+// fine for backends with a single writer.
+func NewMigrator(db *sqlx.DB, fsys fs.FS, locker Locker, l *zap.Logger) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations, locker: locker, l: l}, nil
+}
+
+// Up applies every pending migration in order and returns how many ran.
+// Applied versions this binary does not know, from a newer release, are
+// left alone.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	var applied int
+
+	err := m.locked(ctx, func(conn *sqlx.Conn, done map[uint64]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			insert := conn.Rebind(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`)
+			if err := m.apply(ctx, conn, migration, migration.Up, insert, migration.Version, migration.Name); err != nil {
+				return err
+			}
+
+			m.l.Info("applied migration", zap.Uint64("version", migration.Version), zap.String("name", migration.Name))
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	var rolledBack int
+
+	err := m.locked(ctx, func(conn *sqlx.Conn, done map[uint64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && rolledBack < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("cannot roll back migration %d: %w", migration.Version, ErrNoDownScript)
+			}
+
+			remove := conn.Rebind(`DELETE FROM schema_migrations WHERE version = ?`)
+			if err := m.apply(ctx, conn, migration, migration.Down, remove, migration.Version); err != nil {
+				return err
+			}
+
+			m.l.Info("rolled back migration", zap.Uint64("version", migration.Version), zap.String("name", migration.Name))
+			rolledBack++
+		}
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status lists the known migrations in order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.locked(ctx, func(_ *sqlx.Conn, done map[uint64]time.Time) error {
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := done[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// locked runs fn on a dedicated connection holding the lock, with the
+// applied versions read after locking.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sqlx.Conn, done map[uint64]time.Time) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get migration connection: %w", err)
+	}
+	defer conn.Close()
+
+	if m.locker != nil {
+		if err := m.locker.Lock(ctx, conn); err != nil {
+			return fmt.Errorf("cannot lock migrations: %w", err)
+		}
+
+		defer func() {
+			if err := m.locker.Unlock(context.Background(), conn); err != nil {
+				m.l.Error("cannot unlock migrations", zap.Error(err))
+			}
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("cannot create schema_migrations: %w", err)
+	}
+
+	var rows []struct {
+		Version   uint64    `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	if err := conn.SelectContext(ctx, &rows, `SELECT version, applied_at FROM schema_migrations`); err != nil {
+		return fmt.Errorf("cannot get applied migrations: %w", err)
+	}
+
+	done := make(map[uint64]time.Time, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row.AppliedAt
+	}
+
+	return fn(conn, done)
+}
+
+// apply runs script and the schema_migrations statement in one transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, migration Migration, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin migration %d: %w", migration.Version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("cannot run migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("cannot record migration %d: %w", migration.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit migration %d: %w", migration.Version, err)
+	}
+
+	return nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("cannot list migrations: %w", err)
+	}
+
+	byVersion := make(map[uint64]*Migration)
+
+	for _, file := range files {
+		name := path.Base(file)
+
+		base, direction, ok := cutDirection(name)
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named NNNNNN_name.up.sql or .down.sql", name)
+		}
+
+		number, title, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseUint(number, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version: %w", name, err)
+		}
+
+		script, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read migration %s: %w", name, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != title {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, title)
+		}
+
+		if direction == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func cutDirection(name string) (string, string, bool) {
+	if base, ok := strings.CutSuffix(name, ".up.sql"); ok {
+		return base, "up", true
+	}
+
+	if base, ok := strings.CutSuffix(name, ".down.sql"); ok {
+		return base, "down", true
+	}
+
+	return "", "", false
+}
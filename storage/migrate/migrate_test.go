@@ -0,0 +1,234 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/storage/migrate"
+	"github.com/zhayt/user-service/storage/sqlite"
+	"go.uber.org/zap"
+)
+
+var _migrations = fstest.MapFS{
+	"000001_users.up.sql":   {Data: []byte(`CREATE TABLE users (id INTEGER PRIMARY KEY)`)},
+	"000001_users.down.sql": {Data: []byte(`DROP TABLE users`)},
+	"000002_posts.up.sql":   {Data: []byte(`CREATE TABLE posts (id INTEGER PRIMARY KEY)`)},
+	"000002_posts.down.sql": {Data: []byte(`DROP TABLE posts`)},
+}
+
+// locker records its calls and fails Lock with err.
+type locker struct {
+	calls []string
+	conns []*sqlx.Conn
+	err   error
+}
+
+func (l *locker) Lock(_ context.Context, conn *sqlx.Conn) error {
+	l.calls = append(l.calls, "lock")
+	l.conns = append(l.conns, conn)
+	return l.err
+}
+
+func (l *locker) Unlock(_ context.Context, conn *sqlx.Conn) error {
+	l.calls = append(l.calls, "unlock")
+	l.conns = append(l.conns, conn)
+	return nil
+}
+
+func openDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "migrate.db"), &config.Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func newMigrator(t *testing.T, db *sqlx.DB, fsys fstest.MapFS, locker migrate.Locker) *migrate.Migrator {
+	t.Helper()
+
+	migrator, err := migrate.NewMigrator(db, fsys, locker, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+
+	return migrator
+}
+
+// applied returns the applied versions reported by Status.
+func applied(t *testing.T, migrator *migrate.Migrator) []uint64 {
+	t.Helper()
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+
+	var versions []uint64
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			versions = append(versions, status.Version)
+		}
+	}
+
+	return versions
+}
+
+func hasTable(t *testing.T, db *sqlx.DB, name string) bool {
+	t.Helper()
+
+	var n int
+	if err := db.Get(&n, `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name); err != nil {
+		t.Fatalf("query tables: %v", err)
+	}
+
+	return n == 1
+}
+
+func TestUpDownAndStatus(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	migrator := newMigrator(t, db, _migrations, nil)
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Name != "users" || statuses[1].Name != "posts" || statuses[0].AppliedAt != nil {
+		t.Fatalf("Status() before Up = %+v, want users and posts pending", statuses)
+	}
+
+	if n, err := migrator.Up(ctx); err != nil || n != 2 {
+		t.Fatalf("Up() = %d, %v, want 2", n, err)
+	}
+	if n, err := migrator.Up(ctx); err != nil || n != 0 {
+		t.Fatalf("second Up() = %d, %v, want 0", n, err)
+	}
+	if got := applied(t, migrator); len(got) != 2 {
+		t.Fatalf("applied after Up = %v, want [1 2]", got)
+	}
+
+	// the newest migration is rolled back first
+	if n, err := migrator.Down(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("Down(1) = %d, %v, want 1", n, err)
+	}
+	if got := applied(t, migrator); len(got) != 1 || got[0] != 1 {
+		t.Errorf("applied after Down(1) = %v, want [1]", got)
+	}
+	if !hasTable(t, db, "users") || hasTable(t, db, "posts") {
+		t.Error("Down(1) did not drop exactly the posts table")
+	}
+
+	// more steps than applied migrations roll back what there is
+	if n, err := migrator.Down(ctx, 5); err != nil || n != 1 {
+		t.Fatalf("Down(5) = %d, %v, want 1", n, err)
+	}
+	if got := applied(t, migrator); len(got) != 0 {
+		t.Errorf("applied after Down(5) = %v, want none", got)
+	}
+	if hasTable(t, db, "users") {
+		t.Error("users table left after rolling everything back")
+	}
+}
+
+func TestDownWithoutScript(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	fsys := fstest.MapFS{"000003_tags.up.sql": {Data: []byte(`CREATE TABLE tags (id INTEGER PRIMARY KEY)`)}}
+	for name, file := range _migrations {
+		fsys[name] = file
+	}
+	migrator := newMigrator(t, db, fsys, nil)
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	if n, err := migrator.Down(ctx, 2); !errors.Is(err, migrate.ErrNoDownScript) || n != 0 {
+		t.Fatalf("Down(2) = %d, %v, want %v", n, err, migrate.ErrNoDownScript)
+	}
+
+	// nothing older is rolled back past the missing script
+	if got := applied(t, migrator); len(got) != 3 {
+		t.Errorf("applied after a failed Down = %v, want [1 2 3]", got)
+	}
+	if !hasTable(t, db, "tags") || !hasTable(t, db, "posts") {
+		t.Error("tables dropped by a failed Down")
+	}
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	db := openDB(t)
+
+	fsys := fstest.MapFS{"000003_broken.up.sql": {Data: []byte(`CREATE TABLE tags (id INTEGER PRIMARY KEY); SELECT * FROM missing`)}}
+	for name, file := range _migrations {
+		fsys[name] = file
+	}
+	migrator := newMigrator(t, db, fsys, nil)
+
+	if _, err := migrator.Up(context.Background()); err == nil {
+		t.Fatal("Up succeeded with a broken migration")
+	}
+
+	// the migrations before the broken one stay applied
+	if got := applied(t, migrator); len(got) != 2 {
+		t.Errorf("applied = %v, want [1 2]", got)
+	}
+	if hasTable(t, db, "tags") {
+		t.Error("the broken migration was partly applied")
+	}
+}
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("held around every operation", func(t *testing.T) {
+		lock := &locker{}
+		migrator := newMigrator(t, openDB(t), _migrations, lock)
+
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+		if _, err := migrator.Status(ctx); err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		if _, err := migrator.Down(ctx, 1); err != nil {
+			t.Fatalf("Down: %v", err)
+		}
+
+		if len(lock.calls) != 6 {
+			t.Fatalf("locker calls = %v, want lock and unlock for each operation", lock.calls)
+		}
+		for i := 0; i < len(lock.calls); i += 2 {
+			if lock.calls[i] != "lock" || lock.calls[i+1] != "unlock" || lock.conns[i] != lock.conns[i+1] {
+				t.Errorf("calls %d-%d = %v, want lock and unlock on one connection", i, i+1, lock.calls[i:i+2])
+			}
+		}
+	})
+
+	t.Run("failing lock migrates nothing", func(t *testing.T) {
+		db := openDB(t)
+		lock := &locker{err: errors.New("lock timeout")}
+		migrator := newMigrator(t, db, _migrations, lock)
+
+		if _, err := migrator.Up(ctx); !errors.Is(err, lock.err) {
+			t.Fatalf("Up() error = %v, want %v", err, lock.err)
+		}
+
+		if hasTable(t, db, "users") || hasTable(t, db, "schema_migrations") {
+			t.Error("migrations ran without the lock")
+		}
+		if len(lock.calls) != 1 {
+			t.Errorf("locker calls = %v, want only the failed lock", lock.calls)
+		}
+	})
+}
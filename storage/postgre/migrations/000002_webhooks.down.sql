@@ -0,0 +1,2 @@
+DROP TABLE webhook_dead_letter;
+DROP TABLE webhook;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE web_user DROP COLUMN IF EXISTS version;
@@ -0,0 +1 @@
+ALTER TABLE web_user ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+ALTER TABLE web_user
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS last_login_at;
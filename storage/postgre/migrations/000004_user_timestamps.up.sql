@@ -0,0 +1,17 @@
+ALTER TABLE web_user
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMPTZ;
+
+-- existing users get the migration time as their creation time
+UPDATE web_user SET created_at = now() WHERE created_at IS NULL;
+UPDATE web_user SET updated_at = created_at WHERE updated_at IS NULL;
+
+ALTER TABLE web_user
+    ALTER COLUMN created_at SET DEFAULT now(),
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET DEFAULT now(),
+    ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS web_user_created_at_idx ON web_user (created_at);
+CREATE INDEX IF NOT EXISTS web_user_last_login_at_idx ON web_user (last_login_at);
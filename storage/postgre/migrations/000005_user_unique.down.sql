@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS web_user_name_key;
+DROP INDEX IF EXISTS web_user_email_key;
@@ -0,0 +1,4 @@
+-- fails if duplicates already exist; resolve them by hand first:
+-- SELECT lower(email), count(*) FROM web_user GROUP BY 1 HAVING count(*) > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS web_user_email_key ON web_user (lower(email));
+CREATE UNIQUE INDEX IF NOT EXISTS web_user_name_key ON web_user (lower(name));
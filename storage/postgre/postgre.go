@@ -1,25 +1,54 @@
 package postgre
 
 import (
-	"context"
+	"embed"
 	"fmt"
 	_ "github.com/jackc/pgx/stdlib"
 	"github.com/jmoiron/sqlx"
-	"time"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/storage/migrate"
+	"github.com/zhayt/user-service/storage/sqlstore"
+	"go.uber.org/zap"
+	"io/fs"
 )
 
-func Dial(dsn string) (*sqlx.DB, error) {
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// _migrationLockKey is the advisory lock held while migrating.
+const _migrationLockKey = 7_331_046
+
+// Dial opens the pool and pings postgres until it answers, as
+// sqlstore.Ping does.
+func Dial(dsn string, cfg *config.Config, l *zap.Logger) (*sqlx.DB, error) {
 	db, err := sqlx.Open("pgx", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open db: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	sqlstore.ConfigurePool(db, cfg)
 
-	if err := db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("cannot ping db: %w", err)
+	if err := sqlstore.Ping(db, cfg, l); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
 }
+
+// NewWebhookStorage stores webhooks and their dead letters in db.
+func NewWebhookStorage(db *sqlx.DB, l *zap.Logger) *sqlstore.WebhookStorage {
+	return sqlstore.NewWebhookStorage(db, tracer, l)
+}
+
+// NewMigrator applies the embedded migrations under an advisory lock.
+// Migrations up to 000005 are idempotent, so databases migrated by hand
+// before schema_migrations existed are adopted by running them again.
+func NewMigrator(db *sqlx.DB, l *zap.Logger) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("cannot open migrations: %w", err)
+	}
+
+	return migrate.NewMigrator(db, fsys, migrate.AdvisoryLock(_migrationLockKey), l)
+}
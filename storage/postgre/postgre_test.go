@@ -0,0 +1,123 @@
+package postgre_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/storage"
+	"github.com/zhayt/user-service/storage/postgre"
+	"github.com/zhayt/user-service/storage/storagetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestStorage runs against the database at POSTGRES_TEST_DSN (a postgres://
+// URL), giving each subtest a schema of its own that is dropped afterwards.
+func TestStorage(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	cfg := &config.Config{
+		DBMaxOpenConns:    10,
+		DBMaxIdleConns:    10,
+		DBConnMaxLifetime: time.Minute,
+		DBDialTimeout:     10 * time.Second,
+		DBDialBackoff:     100 * time.Millisecond,
+	}
+	l := zap.NewNop()
+
+	admin, err := postgre.Dial(dsn, cfg, l)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	var n int
+	storagetest.Run(t, func(t *testing.T) *storage.Storage {
+		ctx := context.Background()
+
+		n++
+		schema := fmt.Sprintf("storagetest_%d_%d", os.Getpid(), n)
+		if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+			t.Fatalf("create schema: %v", err)
+		}
+
+		db, err := postgre.Dial(withSearchPath(t, dsn, schema), cfg, l)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+			if _, err := admin.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+				t.Errorf("drop schema: %v", err)
+			}
+		})
+
+		migrator, err := postgre.NewMigrator(db, l)
+		if err != nil {
+			t.Fatalf("NewMigrator: %v", err)
+		}
+
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+
+		return storage.NewStorage(db, nil, cfg, l)
+	})
+}
+
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	t.Helper()
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("POSTGRES_TEST_DSN must be a URL: %v", err)
+	}
+
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func TestDialRetriesUntilTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	// nothing listens on the port any more, so every ping is refused
+	addr := lis.Addr().String()
+	lis.Close()
+
+	cfg := &config.Config{DBDialTimeout: 200 * time.Millisecond, DBDialBackoff: 10 * time.Millisecond}
+	core, logs := observer.New(zapcore.WarnLevel)
+
+	start := time.Now()
+	if _, err := postgre.Dial("postgres://user:password@"+addr+"/users?sslmode=disable", cfg, zap.New(core)); err == nil {
+		t.Fatal("Dial succeeded without postgres")
+	}
+
+	if elapsed := time.Since(start); elapsed < cfg.DBDialTimeout {
+		t.Errorf("Dial gave up after %v, before its %v timeout", elapsed, cfg.DBDialTimeout)
+	}
+
+	retries := logs.FilterMessage("cannot reach db, retrying").All()
+	if len(retries) < 2 {
+		t.Fatalf("got %d retries, want several", len(retries))
+	}
+
+	// the backoff doubles after every failed attempt
+	if first, second := retries[0].ContextMap()["backoff"], retries[1].ContextMap()["backoff"]; first != cfg.DBDialBackoff || second != 2*cfg.DBDialBackoff {
+		t.Errorf("backoffs = %v, %v, want %v doubling", first, second, cfg.DBDialBackoff)
+	}
+}
@@ -0,0 +1,131 @@
+package postgre
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/storage/routing"
+	"github.com/zhayt/user-service/storage/sqlstore"
+	"go.uber.org/zap"
+)
+
+// Replicas routes read-only queries round-robin to the replicas that passed
+// their last health check, and to the primary while none has.
+type Replicas struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	next     atomic.Uint64
+	interval time.Duration
+	timeout  time.Duration
+	l        *zap.Logger
+}
+
+type replica struct {
+	db      *sqlx.DB
+	index   int
+	healthy atomic.Bool
+}
+
+// OpenReplicas opens a pool per cfg.DBReplicaDSNs without connecting. The
+// replicas take reads once Run has found them healthy.
+func OpenReplicas(primary *sqlx.DB, cfg *config.Config, l *zap.Logger) (*Replicas, error) {
+	r := &Replicas{
+		primary:  primary,
+		interval: cfg.HealthCheckInterval,
+		timeout:  cfg.HealthCheckTimeout,
+		l:        l,
+	}
+
+	for _, dsn := range cfg.DBReplicaDSNs {
+		if strings.TrimSpace(dsn) == "" {
+			continue
+		}
+
+		index := len(r.replicas)
+		db, err := sqlx.Open("pgx", dsn)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("cannot open db replica %d: %w", index, err)
+		}
+
+		sqlstore.ConfigurePool(db, cfg)
+		r.replicas = append(r.replicas, &replica{db: db, index: index})
+	}
+
+	return r, nil
+}
+
+// Pools returns the replica pools in config order.
+func (r *Replicas) Pools() []*sqlx.DB {
+	pools := make([]*sqlx.DB, 0, len(r.replicas))
+	for _, replica := range r.replicas {
+		pools = append(pools, replica.db)
+	}
+
+	return pools
+}
+
+// Run pings the replicas every interval until ctx is cancelled.
+func (r *Replicas) Run(ctx context.Context) {
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, replica := range r.replicas {
+			r.check(ctx, replica)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replicas) Close() {
+	for _, replica := range r.replicas {
+		replica.db.Close()
+	}
+}
+
+func (r *Replicas) reader(ctx context.Context) sqlstore.Querier {
+	if routing.UsesPrimary(ctx) {
+		return r.primary
+	}
+
+	n := uint64(len(r.replicas))
+	start := r.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if replica := r.replicas[(start+i)%n]; replica.healthy.Load() {
+			return replica.db
+		}
+	}
+
+	return r.primary
+}
+
+func (r *Replicas) check(ctx context.Context, replica *replica) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// the DSN carries the password, so replicas are logged by index
+	err := replica.db.PingContext(ctx)
+	if err != nil && replica.healthy.Load() {
+		r.l.Error("db replica ping failed, reading from the primary instead", zap.Int("replica", replica.index), zap.Error(err))
+	}
+	if err == nil && !replica.healthy.Load() {
+		r.l.Info("db replica reachable, routing reads to it", zap.Int("replica", replica.index))
+	}
+
+	replica.healthy.Store(err == nil)
+}
@@ -0,0 +1,128 @@
+package postgre
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/storage/routing"
+	"github.com/zhayt/user-service/storage/sqlstore"
+	"go.uber.org/zap"
+)
+
+// fakeDriver opens connections that only answer pings, failing those to
+// the names marked down.
+type fakeDriver struct {
+	mu   sync.Mutex
+	down map[string]bool
+}
+
+var _driver = &fakeDriver{down: make(map[string]bool)}
+
+func init() {
+	sql.Register("postgre-replica-test", _driver)
+}
+
+func (d *fakeDriver) setDown(name string, down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.down[name] = down
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{driver: d, name: name}, nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+	name   string
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	if c.driver.down[c.name] {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func openFake(t *testing.T, name string) *sqlx.DB {
+	t.Helper()
+
+	db, err := sqlx.Open("postgre-replica-test", name)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestReplicasFailover(t *testing.T) {
+	ctx := context.Background()
+	primary := openFake(t, t.Name()+"/primary")
+
+	names := []string{t.Name() + "/replica0", t.Name() + "/replica1"}
+	r := &Replicas{primary: primary, timeout: time.Second, l: zap.NewNop()}
+	for i, name := range names {
+		r.replicas = append(r.replicas, &replica{db: openFake(t, name), index: i})
+	}
+
+	checkAll := func() {
+		for _, replica := range r.replicas {
+			r.check(ctx, replica)
+		}
+	}
+
+	// readers returns the pools the next few reads go to
+	readers := func(ctx context.Context) map[sqlstore.Querier]bool {
+		seen := make(map[sqlstore.Querier]bool)
+		for i := 0; i < 4; i++ {
+			seen[r.reader(ctx)] = true
+		}
+		return seen
+	}
+
+	if got := readers(ctx); len(got) != 1 || !got[primary] {
+		t.Fatal("reads went to replicas never found healthy")
+	}
+
+	checkAll()
+	if got := readers(ctx); len(got) != 2 || !got[r.replicas[0].db] || !got[r.replicas[1].db] {
+		t.Errorf("healthy replicas do not share the reads: %v", got)
+	}
+
+	if got := readers(routing.WithPrimary(ctx)); len(got) != 1 || !got[primary] {
+		t.Error("read-your-writes reads left the primary")
+	}
+
+	_driver.setDown(names[0], true)
+	checkAll()
+	if got := readers(ctx); len(got) != 1 || !got[r.replicas[1].db] {
+		t.Error("reads still reach the failing replica")
+	}
+
+	_driver.setDown(names[1], true)
+	checkAll()
+	if got := readers(ctx); len(got) != 1 || !got[primary] {
+		t.Error("reads did not fail over to the primary")
+	}
+
+	_driver.setDown(names[0], false)
+	checkAll()
+	if got := readers(ctx); len(got) != 1 || !got[r.replicas[0].db] {
+		t.Error("reads did not return to the recovered replica")
+	}
+}
@@ -0,0 +1,8 @@
+package postgre
+
+import (
+	"github.com/zhayt/user-service/storage/sqlstore"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+var tracer = sqlstore.NewTracer("postgre", semconv.DBSystemPostgreSQL)
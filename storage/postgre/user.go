@@ -2,73 +2,251 @@ package postgre
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx"
 	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/config"
 	"github.com/zhayt/user-service/model"
 	"github.com/zhayt/user-service/model/dto"
+	"github.com/zhayt/user-service/storage/sqlstore"
 	"go.uber.org/zap"
+	"strings"
+	"time"
 )
 
+const _uniqueViolationCode = "23505"
+
 type UserStorage struct {
 	db *sqlx.DB
-	l  *zap.Logger
+	// q runs the queries: db, or the transaction of a WithTx storage
+	q sqlstore.Querier
+	// lock is appended to single-user lookups inside transactions
+	lock string
+	// replicas serve the read-only methods; nil inside transactions
+	replicas     *Replicas
+	queryTimeout time.Duration
+	l            *zap.Logger
 }
 
 func (r *UserStorage) CreateUser(ctx context.Context, user *model.User) (uint64, error) {
-	qr := `INSERT INTO web_user (name, email, password) VALUES ($1, $2, $3) RETURNING id`
+	ctx, span := tracer.Start(ctx, "CreateUser")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
 
-	var userID uint64
-	if err := r.db.GetContext(ctx, &userID, qr, user.Name, user.Email, user.Password); err != nil {
-		return 0, fmt.Errorf("cannot create user: %w", err)
+	qr := `INSERT INTO web_user (name, email, password) VALUES ($1, $2, $3) RETURNING id, version, created_at, updated_at`
+
+	row := r.q.QueryRowxContext(ctx, qr, user.Name, user.Email, user.Password)
+	if err := row.Scan(&user.ID, &user.Version, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return 0, sqlstore.SpanError(span, fmt.Errorf("cannot create user: %w", sqlstore.UniqueViolation(err, violatedIndex)))
 	}
 
-	return userID, nil
+	return user.ID, nil
 }
 
 func (r *UserStorage) GetUserByID(ctx context.Context, id uint64) (*model.User, error) {
-	qr := `SELECT id, name, email, password FROM web_user WHERE id = $1`
+	ctx, span := tracer.Start(ctx, "GetUserByID")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `SELECT ` + sqlstore.UserColumns + ` FROM web_user WHERE id = $1` + r.lock
 
 	var user model.User
 
-	if err := r.db.GetContext(ctx, &user, qr, id); err != nil {
-		return nil, fmt.Errorf("cannot get user by id: %w", err)
+	if err := r.reader(ctx).GetContext(ctx, &user, qr, id); err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot get user by id: %w", sqlstore.UserNotFound(err)))
 	}
 
 	return &user, nil
 }
 
 func (r *UserStorage) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
-	qr := `SELECT id, name, email, password FROM web_user WHERE email = $1`
+	ctx, span := tracer.Start(ctx, "GetUserByEmail")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `SELECT ` + sqlstore.UserColumns + ` FROM web_user WHERE lower(email) = lower($1)` + r.lock
 
 	var user model.User
 
-	if err := r.db.GetContext(ctx, &user, qr, email); err != nil {
-		return nil, fmt.Errorf("cannot get user by id: %w", err)
+	if err := r.reader(ctx).GetContext(ctx, &user, qr, email); err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot get user by email: %w", sqlstore.UserNotFound(err)))
 	}
 
 	return &user, nil
 }
 
-func (r *UserStorage) UpdateUserPassword(ctx context.Context, user *dto.ChangeUserPasswordDTO) error {
-	qr := `UPDATE web_user SET password = $1 WHERE email = $2`
+func (r *UserStorage) GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error) {
+	ctx, span := tracer.Start(ctx, "GetUsersByIDs")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	qr, args, err := sqlx.In(`SELECT `+sqlstore.UserColumns+` FROM web_user WHERE id IN (?)`, ids)
+	if err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot build users by ids query: %w", err))
+	}
+
+	var users []*model.User
+
+	if err := r.reader(ctx).SelectContext(ctx, &users, r.q.Rebind(qr), args...); err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot get users by ids: %w", err))
+	}
+
+	return users, nil
+}
+
+func (r *UserStorage) SearchUsers(ctx context.Context, filter *model.UserFilter) ([]*model.User, error) {
+	ctx, span := tracer.Start(ctx, "SearchUsers")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	conds := []string{`name ILIKE $1 ESCAPE '\'`}
+	args := []interface{}{"%" + sqlstore.EscapeLike(filter.Query) + "%"}
+
+	where := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.CreatedAfter != nil {
+		where("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at < $%d", *filter.CreatedBefore)
+	}
+	if filter.LastLoginAfter != nil {
+		where("last_login_at >= $%d", *filter.LastLoginAfter)
+	}
+	if filter.LastLoginBefore != nil {
+		where("(last_login_at IS NULL OR last_login_at < $%d)", *filter.LastLoginBefore)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	qr := fmt.Sprintf(`SELECT `+sqlstore.UserColumns+` FROM web_user WHERE %s ORDER BY id LIMIT $%d OFFSET $%d`,
+		strings.Join(conds, " AND "), len(args)-1, len(args))
 
-	if _, err := r.db.ExecContext(ctx, qr, user.NewPassword, user.Email); err != nil {
-		return fmt.Errorf("cannot update user password: %w", err)
+	var users []*model.User
+
+	if err := r.reader(ctx).SelectContext(ctx, &users, qr, args...); err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot search users: %w", err))
+	}
+
+	return users, nil
+}
+
+func (r *UserStorage) UpdateLastLogin(ctx context.Context, id uint64) error {
+	ctx, span := tracer.Start(ctx, "UpdateLastLogin")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `UPDATE web_user SET last_login_at = now() WHERE id = $1`
+
+	res, err := r.q.ExecContext(ctx, qr, id)
+	if err != nil {
+		return sqlstore.SpanError(span, fmt.Errorf("cannot update user last login: %w", err))
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sqlstore.SpanError(span, fmt.Errorf("cannot update user last login: %w", sqlstore.UserNotFound(sql.ErrNoRows)))
 	}
 
 	return nil
 }
 
-func (r *UserStorage) UpdateUserName(ctx context.Context, user *dto.ChangeUserNameDTO) error {
-	qr := `UPDATE web_user SET name = $1 WHERE email = $2`
+func (r *UserStorage) UpdateUserPassword(ctx context.Context, user *dto.ChangeUserPasswordDTO) (uint64, error) {
+	ctx, span := tracer.Start(ctx, "UpdateUserPassword")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `UPDATE web_user SET password = $1, version = version + 1, updated_at = now()
+		WHERE id = $2 AND ($3::BIGINT = 0 OR version = $3) RETURNING version`
+
+	version, err := sqlstore.UpdateVersioned(ctx, r.q, qr, user.NewPassword, user.ID, user.ExpectedVersion)
+	if err != nil {
+		return 0, sqlstore.SpanError(span, fmt.Errorf("cannot update user password: %w", err))
+	}
+
+	return version, nil
+}
+
+func (r *UserStorage) UpdateUserName(ctx context.Context, user *dto.ChangeUserNameDTO) (uint64, error) {
+	ctx, span := tracer.Start(ctx, "UpdateUserName")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
 
-	if _, err := r.db.ExecContext(ctx, qr, user.Name, user.Email); err != nil {
-		return fmt.Errorf("cannot update user name: %w", err)
+	qr := `UPDATE web_user SET name = $1, version = version + 1, updated_at = now()
+		WHERE id = $2 AND ($3::BIGINT = 0 OR version = $3) RETURNING version`
+
+	version, err := sqlstore.UpdateVersioned(ctx, r.q, qr, user.Name, user.ID, user.ExpectedVersion)
+	if err != nil {
+		return 0, sqlstore.SpanError(span, fmt.Errorf("cannot update user name: %w", sqlstore.UniqueViolation(err, violatedIndex)))
+	}
+
+	return version, nil
+}
+
+// WithTx runs fn with a storage bound to a new transaction and commits when
+// fn returns nil. Its lookups by id and email lock the row FOR UPDATE, so
+// concurrent read-check-write flows on one user run one after another.
+func (r *UserStorage) WithTx(ctx context.Context, fn func(tx *UserStorage) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&UserStorage{db: r.db, q: tx, lock: ` FOR UPDATE`, queryTimeout: r.queryTimeout, l: r.l}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
 	}
 
 	return nil
 }
 
-func NewUserStorage(db *sqlx.DB, l *zap.Logger) *UserStorage {
-	return &UserStorage{db: db, l: l}
+// NewUserStorage routes reads through replicas when it is not nil.
+func NewUserStorage(db *sqlx.DB, replicas *Replicas, cfg *config.Config, l *zap.Logger) *UserStorage {
+	return &UserStorage{db: db, q: db, replicas: replicas, queryTimeout: cfg.DBQueryTimeout, l: l}
+}
+
+// reader returns where read-only queries run.
+func (r *UserStorage) reader(ctx context.Context) sqlstore.Querier {
+	if r.replicas == nil {
+		return r.q
+	}
+
+	return r.replicas.reader(ctx)
+}
+
+// violatedIndex names the index a unique violation reported by postgres is on.
+func violatedIndex(err error) (string, bool) {
+	var pgErr pgx.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != _uniqueViolationCode {
+		return "", false
+	}
+
+	return pgErr.ConstraintName, true
 }
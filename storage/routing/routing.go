@@ -0,0 +1,20 @@
+// Package routing carries the read routing of a request in its context, so
+// the storage wrappers and the backends that honour it need not import
+// each other.
+package routing
+
+import "context"
+
+type primaryKey struct{}
+
+// WithPrimary makes read-only queries made with ctx run on the primary, so
+// a caller reading right after a mutation sees it despite replication lag.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary reports whether ctx was passed through WithPrimary.
+func UsesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
@@ -0,0 +1,34 @@
+-- the SQLite schema starts at the state of postgres migration 000005
+CREATE TABLE IF NOT EXISTS web_user (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    password TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    last_login_at DATETIME
+);
+
+-- lower() only folds ASCII in SQLite
+CREATE UNIQUE INDEX IF NOT EXISTS web_user_email_key ON web_user (lower(email));
+CREATE UNIQUE INDEX IF NOT EXISTS web_user_name_key ON web_user (lower(name));
+CREATE INDEX IF NOT EXISTS web_user_created_at_idx ON web_user (created_at);
+CREATE INDEX IF NOT EXISTS web_user_last_login_at_idx ON web_user (last_login_at);
+
+CREATE TABLE IF NOT EXISTS webhook (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letter (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
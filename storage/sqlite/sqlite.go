@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/storage/migrate"
+	"github.com/zhayt/user-service/storage/sqlstore"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// the shared queries are rebound to the driver's bindvars; sqlx does not
+// know this driver by name
+func init() {
+	sqlx.BindDriver("sqlite", sqlx.QUESTION)
+}
+
+// params are set on every connection: foreign keys cascade dead letters
+// like postgres, writers wait for the lock instead of failing, and
+// transactions take the write lock when they begin rather than on their
+// first write.
+var params = []string{
+	"_pragma=foreign_keys(1)", "_pragma=busy_timeout(5000)", "_pragma=journal_mode(WAL)", "_txlock=immediate",
+}
+
+// Open opens the database at dsn (a file path or "file:" URI), creating it
+// if needed, and pings it as sqlstore.Ping does. The pool follows cfg, but
+// SQLite allows a single writer, so it keeps exactly one connection, which
+// also holds in-memory databases. The schema is applied by NewMigrator.
+func Open(dsn string, cfg *config.Config, l *zap.Logger) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite", withParams(dsn))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open db: %w", err)
+	}
+
+	sqlstore.ConfigurePool(db, cfg)
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	if err := sqlstore.Ping(db, cfg, l); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewMigrator applies the embedded migrations. SQLite has a single writer,
+// so no lock is taken.
+func NewMigrator(db *sqlx.DB, l *zap.Logger) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("cannot open migrations: %w", err)
+	}
+
+	return migrate.NewMigrator(db, fsys, nil, l)
+}
+
+// NewWebhookStorage stores webhooks and their dead letters in db.
+func NewWebhookStorage(db *sqlx.DB, l *zap.Logger) *sqlstore.WebhookStorage {
+	return sqlstore.NewWebhookStorage(db, tracer, l)
+}
+
+func withParams(dsn string) string {
+	var b strings.Builder
+	b.WriteString(dsn)
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+
+	for _, param := range params {
+		b.WriteString(sep + param)
+		sep = "&"
+	}
+
+	return b.String()
+}
+
+// now is the timestamp written to the database. Times are stored as UTC
+// text so they compare in order.
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,68 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/storage"
+	"github.com/zhayt/user-service/storage/sqlite"
+	"github.com/zhayt/user-service/storage/storagetest"
+	"go.uber.org/zap"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) *storage.Storage {
+		l := zap.NewNop()
+
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"), &config.Config{}, l)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		migrator, err := sqlite.NewMigrator(db, l)
+		if err != nil {
+			t.Fatalf("NewMigrator: %v", err)
+		}
+
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+
+		return storage.NewSQLiteStorage(db, &config.Config{}, l)
+	})
+}
+
+func TestOpenAppliesPoolAndDialSettings(t *testing.T) {
+	cfg := &config.Config{
+		DBMaxOpenConns:    25,
+		DBMaxIdleConns:    0,
+		DBConnMaxLifetime: time.Minute,
+		DBDialTimeout:     100 * time.Millisecond,
+		DBDialBackoff:     10 * time.Millisecond,
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"), cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// a single writer, whatever the pool settings
+	if got := db.Stats().MaxOpenConnections; got != 1 {
+		t.Errorf("max open connections = %d, want 1", got)
+	}
+
+	// the directory does not exist, so every ping fails until the timeout
+	start := time.Now()
+	if _, err := sqlite.Open(filepath.Join(t.TempDir(), "missing", "users.db"), cfg, zap.NewNop()); err == nil {
+		t.Fatal("Open succeeded in a missing directory")
+	}
+
+	if elapsed := time.Since(start); elapsed < cfg.DBDialTimeout {
+		t.Errorf("Open gave up after %v, before its %v dial timeout", elapsed, cfg.DBDialTimeout)
+	}
+}
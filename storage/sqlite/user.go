@@ -0,0 +1,240 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/model/dto"
+	"github.com/zhayt/user-service/storage/sqlstore"
+	"go.uber.org/zap"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strings"
+	"time"
+)
+
+type UserStorage struct {
+	db *sqlx.DB
+	// q runs the queries: db, or the transaction of a WithTx storage
+	q            sqlstore.Querier
+	queryTimeout time.Duration
+	l            *zap.Logger
+}
+
+func (r *UserStorage) CreateUser(ctx context.Context, user *model.User) (uint64, error) {
+	ctx, span := tracer.Start(ctx, "CreateUser")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `INSERT INTO web_user (name, email, password, created_at, updated_at) VALUES (?1, ?2, ?3, ?4, ?4)
+		RETURNING id, version, created_at, updated_at`
+
+	row := r.q.QueryRowxContext(ctx, qr, user.Name, user.Email, user.Password, now())
+	if err := row.Scan(&user.ID, &user.Version, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return 0, sqlstore.SpanError(span, fmt.Errorf("cannot create user: %w", sqlstore.UniqueViolation(err, violatedIndex)))
+	}
+
+	return user.ID, nil
+}
+
+func (r *UserStorage) GetUserByID(ctx context.Context, id uint64) (*model.User, error) {
+	ctx, span := tracer.Start(ctx, "GetUserByID")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `SELECT ` + sqlstore.UserColumns + ` FROM web_user WHERE id = ?`
+
+	var user model.User
+
+	if err := r.q.GetContext(ctx, &user, qr, id); err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot get user by id: %w", sqlstore.UserNotFound(err)))
+	}
+
+	return &user, nil
+}
+
+func (r *UserStorage) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := tracer.Start(ctx, "GetUserByEmail")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `SELECT ` + sqlstore.UserColumns + ` FROM web_user WHERE lower(email) = lower(?)`
+
+	var user model.User
+
+	if err := r.q.GetContext(ctx, &user, qr, email); err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot get user by email: %w", sqlstore.UserNotFound(err)))
+	}
+
+	return &user, nil
+}
+
+func (r *UserStorage) GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error) {
+	ctx, span := tracer.Start(ctx, "GetUsersByIDs")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	qr, args, err := sqlx.In(`SELECT `+sqlstore.UserColumns+` FROM web_user WHERE id IN (?)`, ids)
+	if err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot build users by ids query: %w", err))
+	}
+
+	var users []*model.User
+
+	if err := r.q.SelectContext(ctx, &users, qr, args...); err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot get users by ids: %w", err))
+	}
+
+	return users, nil
+}
+
+// SearchUsers matches names with LIKE, which SQLite folds for ASCII only.
+func (r *UserStorage) SearchUsers(ctx context.Context, filter *model.UserFilter) ([]*model.User, error) {
+	ctx, span := tracer.Start(ctx, "SearchUsers")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	conds := []string{`name LIKE ? ESCAPE '\'`}
+	args := []interface{}{"%" + sqlstore.EscapeLike(filter.Query) + "%"}
+
+	where := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+
+	if filter.CreatedAfter != nil {
+		where("created_at >= ?", filter.CreatedAfter.UTC())
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at < ?", filter.CreatedBefore.UTC())
+	}
+	if filter.LastLoginAfter != nil {
+		where("last_login_at >= ?", filter.LastLoginAfter.UTC())
+	}
+	if filter.LastLoginBefore != nil {
+		where("(last_login_at IS NULL OR last_login_at < ?)", filter.LastLoginBefore.UTC())
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	qr := `SELECT ` + sqlstore.UserColumns + ` FROM web_user WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY id LIMIT ? OFFSET ?`
+
+	var users []*model.User
+
+	if err := r.q.SelectContext(ctx, &users, qr, args...); err != nil {
+		return nil, sqlstore.SpanError(span, fmt.Errorf("cannot search users: %w", err))
+	}
+
+	return users, nil
+}
+
+func (r *UserStorage) UpdateLastLogin(ctx context.Context, id uint64) error {
+	ctx, span := tracer.Start(ctx, "UpdateLastLogin")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `UPDATE web_user SET last_login_at = ? WHERE id = ?`
+
+	res, err := r.q.ExecContext(ctx, qr, now(), id)
+	if err != nil {
+		return sqlstore.SpanError(span, fmt.Errorf("cannot update user last login: %w", err))
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sqlstore.SpanError(span, fmt.Errorf("cannot update user last login: %w", sqlstore.UserNotFound(sql.ErrNoRows)))
+	}
+
+	return nil
+}
+
+func (r *UserStorage) UpdateUserPassword(ctx context.Context, user *dto.ChangeUserPasswordDTO) (uint64, error) {
+	ctx, span := tracer.Start(ctx, "UpdateUserPassword")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `UPDATE web_user SET password = ?1, version = version + 1, updated_at = ?4
+		WHERE id = ?2 AND (?3 = 0 OR version = ?3) RETURNING version`
+
+	version, err := sqlstore.UpdateVersioned(ctx, r.q, qr, user.NewPassword, user.ID, user.ExpectedVersion, now())
+	if err != nil {
+		return 0, sqlstore.SpanError(span, fmt.Errorf("cannot update user password: %w", err))
+	}
+
+	return version, nil
+}
+
+func (r *UserStorage) UpdateUserName(ctx context.Context, user *dto.ChangeUserNameDTO) (uint64, error) {
+	ctx, span := tracer.Start(ctx, "UpdateUserName")
+	defer span.End()
+
+	ctx, cancel := sqlstore.WithTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	qr := `UPDATE web_user SET name = ?1, version = version + 1, updated_at = ?4
+		WHERE id = ?2 AND (?3 = 0 OR version = ?3) RETURNING version`
+
+	version, err := sqlstore.UpdateVersioned(ctx, r.q, qr, user.Name, user.ID, user.ExpectedVersion, now())
+	if err != nil {
+		return 0, sqlstore.SpanError(span, fmt.Errorf("cannot update user name: %w", sqlstore.UniqueViolation(err, violatedIndex)))
+	}
+
+	return version, nil
+}
+
+// WithTx runs fn with a storage bound to a new transaction and commits when
+// fn returns nil. SQLite has no row locks; the transaction takes the write
+// lock when it begins (see Open), which serialises it with every other
+// writer.
+func (r *UserStorage) WithTx(ctx context.Context, fn func(tx *UserStorage) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&UserStorage{db: r.db, q: tx, queryTimeout: r.queryTimeout, l: r.l}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func NewUserStorage(db *sqlx.DB, cfg *config.Config, l *zap.Logger) *UserStorage {
+	return &UserStorage{db: db, q: db, queryTimeout: cfg.DBQueryTimeout, l: l}
+}
+
+// violatedIndex returns the message of a unique violation: SQLite only
+// names the index there.
+func violatedIndex(err error) (string, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return "", false
+	}
+
+	return sqliteErr.Error(), true
+}
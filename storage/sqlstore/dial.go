@@ -0,0 +1,61 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/config"
+	"go.uber.org/zap"
+)
+
+// _maxDialBackoff caps the wait between dial attempts.
+const _maxDialBackoff = 10 * time.Second
+
+// Pinger is implemented by *sqlx.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// ConfigurePool applies the pool settings of cfg to db.
+func ConfigurePool(db *sqlx.DB, cfg *config.Config) {
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+}
+
+// Ping pings db until it answers, so the service survives its database
+// starting after it. Attempts back off exponentially from cfg.DBDialBackoff
+// and stop after cfg.DBDialTimeout; without a timeout db is pinged once.
+func Ping(db Pinger, cfg *config.Config, l *zap.Logger) error {
+	if cfg.DBDialTimeout <= 0 {
+		if err := db.PingContext(context.Background()); err != nil {
+			return fmt.Errorf("cannot ping db: %w", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DBDialTimeout)
+	defer cancel()
+
+	backoff := cfg.DBDialBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		l.Warn("cannot reach db, retrying", zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cannot ping db after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > _maxDialBackoff {
+			backoff = _maxDialBackoff
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package sqlstore_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/storage/sqlstore"
+	"go.uber.org/zap"
+)
+
+var errRefused = errors.New("connection refused")
+
+// pinger fails the first failures pings and records when each was made.
+type pinger struct {
+	mu       sync.Mutex
+	failures int
+	times    []time.Time
+}
+
+func (p *pinger) PingContext(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.times = append(p.times, time.Now())
+	if len(p.times) <= p.failures {
+		return errRefused
+	}
+	return nil
+}
+
+func TestPingRetriesWithBackoff(t *testing.T) {
+	cfg := &config.Config{DBDialTimeout: 5 * time.Second, DBDialBackoff: 20 * time.Millisecond}
+	db := &pinger{failures: 3}
+
+	if err := sqlstore.Ping(db, cfg, zap.NewNop()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	if len(db.times) != 4 {
+		t.Fatalf("got %d pings, want 4", len(db.times))
+	}
+
+	// the backoff doubles after every failed attempt
+	for i, want := range []time.Duration{cfg.DBDialBackoff, 2 * cfg.DBDialBackoff, 4 * cfg.DBDialBackoff} {
+		if got := db.times[i+1].Sub(db.times[i]); got < want {
+			t.Errorf("wait before attempt %d = %v, want at least %v", i+2, got, want)
+		}
+	}
+}
+
+func TestPingGivesUpAfterTimeout(t *testing.T) {
+	cfg := &config.Config{DBDialTimeout: 100 * time.Millisecond, DBDialBackoff: 10 * time.Millisecond}
+	db := &pinger{failures: 1 << 30}
+
+	start := time.Now()
+	err := sqlstore.Ping(db, cfg, zap.NewNop())
+
+	if !errors.Is(err, errRefused) || !strings.Contains(err.Error(), "attempts") {
+		t.Fatalf("Ping() error = %v, want the last ping error after several attempts", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < cfg.DBDialTimeout || elapsed > 5*time.Second {
+		t.Errorf("Ping gave up after %v, want about %v", elapsed, cfg.DBDialTimeout)
+	}
+
+	if len(db.times) < 2 {
+		t.Errorf("got %d pings, want retries", len(db.times))
+	}
+}
+
+func TestPingWithoutTimeoutPingsOnce(t *testing.T) {
+	db := &pinger{failures: 1}
+
+	if err := sqlstore.Ping(db, &config.Config{}, zap.NewNop()); !errors.Is(err, errRefused) {
+		t.Fatalf("Ping() error = %v, want %v", err, errRefused)
+	}
+
+	if len(db.times) != 1 {
+		t.Errorf("got %d pings, want 1", len(db.times))
+	}
+}
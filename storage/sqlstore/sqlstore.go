@@ -0,0 +1,89 @@
+// Package sqlstore holds what the postgres and sqlite backends share: the
+// webhook storage, tracing and the helpers of their user storages. Shared
+// queries are written with ? bindvars and rebound to the driver's.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/errs"
+)
+
+// UserColumns are the web_user columns scanned into a model.User.
+const UserColumns = `id, name, email, password, version, created_at, updated_at, last_login_at`
+
+// Querier is implemented by *sqlx.DB and *sqlx.Tx.
+type Querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// WithTimeout bounds one query by timeout; 0 disables it.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// UpdateVersioned runs a conditional UPDATE ... RETURNING version. No row
+// means the expected version did not match, or the user is gone.
+func UpdateVersioned(ctx context.Context, q Querier, qr string, args ...interface{}) (uint64, error) {
+	var version uint64
+	if err := q.GetContext(ctx, &version, qr, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errs.UserVersionConflict()
+		}
+
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// uniqueFields maps the unique indexes on web_user to the fields they guard.
+var uniqueFields = map[string]string{
+	"web_user_email_key": "email",
+	"web_user_name_key":  "name",
+}
+
+// UniqueViolation turns a unique index violation into an errs.ErrConflict
+// naming the field and returns other errors unchanged. violated reports
+// whether err is a unique violation, with the text naming the index: the
+// constraint name, or the whole message where the driver has nothing else.
+func UniqueViolation(err error, violated func(err error) (index string, ok bool)) error {
+	index, ok := violated(err)
+	if !ok {
+		return err
+	}
+
+	for name, field := range uniqueFields {
+		if strings.Contains(index, name) {
+			return errs.UserExists(field).WithCause(err)
+		}
+	}
+
+	return err
+}
+
+// UserNotFound turns sql.ErrNoRows into an errs.ErrNotFound and returns
+// other errors unchanged.
+func UserNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.UserNotFound().WithCause(err)
+	}
+
+	return err
+}
+
+// EscapeLike escapes the LIKE wildcards in s so user input is matched literally.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,42 @@
+package sqlstore
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts the spans of one backend.
+type Tracer struct {
+	tracer  trace.Tracer
+	backend string
+	system  attribute.KeyValue
+}
+
+// NewTracer names spans "<backend>.<statement>" and tags them with system.
+func NewTracer(backend string, system attribute.KeyValue) *Tracer {
+	return &Tracer{
+		tracer:  otel.Tracer("github.com/zhayt/user-service/storage/" + backend),
+		backend: backend,
+		system:  system,
+	}
+}
+
+// Start starts a client span for one storage statement, named after it.
+func (t *Tracer) Start(ctx context.Context, statement string) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, t.backend+"."+statement,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.system, semconv.DBOperation(statement)),
+	)
+}
+
+// SpanError marks span as failed and returns err unchanged.
+func SpanError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
@@ -0,0 +1,163 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+	"go.uber.org/zap"
+)
+
+type WebhookStorage struct {
+	db     *sqlx.DB
+	tracer *Tracer
+	l      *zap.Logger
+}
+
+type webhookRow struct {
+	ID     uint64 `db:"id"`
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+	Events string `db:"events"`
+}
+
+func (r *WebhookStorage) CreateWebhook(ctx context.Context, webhook *model.Webhook) (uint64, error) {
+	ctx, span := r.tracer.Start(ctx, "CreateWebhook")
+	defer span.End()
+
+	qr := `INSERT INTO webhook (url, secret, events) VALUES (?, ?, ?) RETURNING id`
+
+	var webhookID uint64
+	if err := r.db.GetContext(ctx, &webhookID, r.db.Rebind(qr), webhook.URL, webhook.Secret, model.JoinEvents(webhook.Events)); err != nil {
+		return 0, SpanError(span, fmt.Errorf("cannot create webhook: %w", err))
+	}
+
+	return webhookID, nil
+}
+
+func (r *WebhookStorage) GetWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	ctx, span := r.tracer.Start(ctx, "GetWebhooks")
+	defer span.End()
+
+	qr := `SELECT id, url, secret, events FROM webhook ORDER BY id`
+
+	var rows []webhookRow
+	if err := r.db.SelectContext(ctx, &rows, qr); err != nil {
+		return nil, SpanError(span, fmt.Errorf("cannot get webhooks: %w", err))
+	}
+
+	webhooks := make([]*model.Webhook, 0, len(rows))
+	for _, row := range rows {
+		webhooks = append(webhooks, &model.Webhook{
+			ID:     row.ID,
+			URL:    row.URL,
+			Secret: row.Secret,
+			Events: model.SplitEvents(row.Events),
+		})
+	}
+
+	return webhooks, nil
+}
+
+func (r *WebhookStorage) GetWebhookByID(ctx context.Context, id uint64) (*model.Webhook, error) {
+	ctx, span := r.tracer.Start(ctx, "GetWebhookByID")
+	defer span.End()
+
+	qr := `SELECT id, url, secret, events FROM webhook WHERE id = ?`
+
+	var row webhookRow
+	if err := r.db.GetContext(ctx, &row, r.db.Rebind(qr), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.WebhookNotFound().WithCause(err)
+		}
+
+		return nil, SpanError(span, fmt.Errorf("cannot get webhook by id: %w", err))
+	}
+
+	return &model.Webhook{
+		ID:     row.ID,
+		URL:    row.URL,
+		Secret: row.Secret,
+		Events: model.SplitEvents(row.Events),
+	}, nil
+}
+
+func (r *WebhookStorage) DeleteWebhook(ctx context.Context, id uint64) error {
+	ctx, span := r.tracer.Start(ctx, "DeleteWebhook")
+	defer span.End()
+
+	qr := `DELETE FROM webhook WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(qr), id); err != nil {
+		return SpanError(span, fmt.Errorf("cannot delete webhook: %w", err))
+	}
+
+	return nil
+}
+
+func (r *WebhookStorage) CreateDeadLetter(ctx context.Context, letter *model.WebhookDeadLetter) error {
+	ctx, span := r.tracer.Start(ctx, "CreateDeadLetter")
+	defer span.End()
+
+	qr := `INSERT INTO webhook_dead_letter (webhook_id, event_type, payload, attempts, last_error) VALUES (?, ?, ?, ?, ?)`
+
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(qr), letter.WebhookID, letter.EventType, letter.Payload, letter.Attempts, letter.LastError); err != nil {
+		return SpanError(span, fmt.Errorf("cannot create webhook dead letter: %w", err))
+	}
+
+	return nil
+}
+
+func (r *WebhookStorage) GetDeadLetters(ctx context.Context, webhookID uint64) ([]*model.WebhookDeadLetter, error) {
+	ctx, span := r.tracer.Start(ctx, "GetDeadLetters")
+	defer span.End()
+
+	qr := `SELECT id, webhook_id, event_type, payload, attempts, last_error FROM webhook_dead_letter
+		WHERE ? = 0 OR webhook_id = ? ORDER BY id`
+
+	var letters []*model.WebhookDeadLetter
+	if err := r.db.SelectContext(ctx, &letters, r.db.Rebind(qr), webhookID, webhookID); err != nil {
+		return nil, SpanError(span, fmt.Errorf("cannot get webhook dead letters: %w", err))
+	}
+
+	return letters, nil
+}
+
+func (r *WebhookStorage) GetDeadLettersByIDs(ctx context.Context, ids []uint64) ([]*model.WebhookDeadLetter, error) {
+	ctx, span := r.tracer.Start(ctx, "GetDeadLettersByIDs")
+	defer span.End()
+
+	qr, args, err := sqlx.In(`SELECT id, webhook_id, event_type, payload, attempts, last_error FROM webhook_dead_letter
+		WHERE id IN (?) ORDER BY id`, ids)
+	if err != nil {
+		return nil, SpanError(span, fmt.Errorf("cannot build dead letters query: %w", err))
+	}
+
+	var letters []*model.WebhookDeadLetter
+	if err := r.db.SelectContext(ctx, &letters, r.db.Rebind(qr), args...); err != nil {
+		return nil, SpanError(span, fmt.Errorf("cannot get webhook dead letters by ids: %w", err))
+	}
+
+	return letters, nil
+}
+
+func (r *WebhookStorage) DeleteDeadLetter(ctx context.Context, id uint64) error {
+	ctx, span := r.tracer.Start(ctx, "DeleteDeadLetter")
+	defer span.End()
+
+	qr := `DELETE FROM webhook_dead_letter WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, r.db.Rebind(qr), id); err != nil {
+		return SpanError(span, fmt.Errorf("cannot delete webhook dead letter: %w", err))
+	}
+
+	return nil
+}
+
+// NewWebhookStorage traces its statements with tracer.
+func NewWebhookStorage(db *sqlx.DB, tracer *Tracer, l *zap.Logger) *WebhookStorage {
+	return &WebhookStorage{db: db, tracer: tracer, l: l}
+}
@@ -3,25 +3,96 @@ package storage
 import (
 	"context"
 	"github.com/jmoiron/sqlx"
+	"github.com/zhayt/user-service/config"
 	"github.com/zhayt/user-service/model"
 	"github.com/zhayt/user-service/model/dto"
+	"github.com/zhayt/user-service/storage/memory"
 	"github.com/zhayt/user-service/storage/postgre"
+	"github.com/zhayt/user-service/storage/routing"
+	"github.com/zhayt/user-service/storage/sqlite"
 	"go.uber.org/zap"
 )
 
+// IStorage is the user storage. Lookups return errs.ErrNotFound for unknown
+// users and writes return errs.ErrConflict for a duplicate email or name.
 type IStorage interface {
 	CreateUser(ctx context.Context, user *model.User) (uint64, error)
 	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
-	UpdateUserPassword(ctx context.Context, user *dto.ChangeUserPasswordDTO) error
-	UpdateUserName(ctx context.Context, user *dto.ChangeUserNameDTO) error
+	GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error)
+	SearchUsers(ctx context.Context, filter *model.UserFilter) ([]*model.User, error)
+	UpdateLastLogin(ctx context.Context, id uint64) error
+	// UpdateUserPassword and UpdateUserName return the new user version, or
+	// errs.ErrVersionConflict when ExpectedVersion is set and stale.
+	UpdateUserPassword(ctx context.Context, user *dto.ChangeUserPasswordDTO) (uint64, error)
+	UpdateUserName(ctx context.Context, user *dto.ChangeUserNameDTO) (uint64, error)
 }
 
+type IWebhookStorage interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) (uint64, error)
+	GetWebhooks(ctx context.Context) ([]*model.Webhook, error)
+	GetWebhookByID(ctx context.Context, id uint64) (*model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uint64) error
+	CreateDeadLetter(ctx context.Context, letter *model.WebhookDeadLetter) error
+	GetDeadLetters(ctx context.Context, webhookID uint64) ([]*model.WebhookDeadLetter, error)
+	GetDeadLettersByIDs(ctx context.Context, ids []uint64) ([]*model.WebhookDeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id uint64) error
+}
+
+// Backends accepted by config.StorageBackend.
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// Storage bundles the user and webhook storages of one backend. Every
+// backend must pass storagetest.Run.
 type Storage struct {
 	IStorage
+	IWebhookStorage
+	withTx func(ctx context.Context, fn func(tx IStorage) error) error
+}
+
+// WithTx runs fn in a transaction of the user storage, committing when fn
+// returns nil and rolling back otherwise. Lookups by id or email through tx
+// lock the user until the transaction ends, so read-check-write flows
+// cannot interleave. fn must only use tx: other calls may wait for the
+// transaction to end.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx IStorage) error) error {
+	return s.withTx(ctx, fn)
+}
+
+// NewStorage returns the postgres backend; replicas may be nil.
+func NewStorage(db *sqlx.DB, replicas *postgre.Replicas, cfg *config.Config, l *zap.Logger) *Storage {
+	userStorage := postgre.NewUserStorage(db, replicas, cfg, l)
+	webhookStorage := postgre.NewWebhookStorage(db, l)
+	return &Storage{userStorage, webhookStorage, func(ctx context.Context, fn func(tx IStorage) error) error {
+		return userStorage.WithTx(ctx, func(tx *postgre.UserStorage) error { return fn(tx) })
+	}}
+}
+
+// ReadYourWrites makes lookups made with ctx read from the primary instead
+// of a replica, for reads that must see a mutation made just before. It
+// has no effect on backends without replicas.
+func ReadYourWrites(ctx context.Context) context.Context {
+	return routing.WithPrimary(ctx)
+}
+
+// NewSQLiteStorage expects db from sqlite.Open.
+func NewSQLiteStorage(db *sqlx.DB, cfg *config.Config, l *zap.Logger) *Storage {
+	userStorage := sqlite.NewUserStorage(db, cfg, l)
+	return &Storage{userStorage, sqlite.NewWebhookStorage(db, l), func(ctx context.Context, fn func(tx IStorage) error) error {
+		return userStorage.WithTx(ctx, func(tx *sqlite.UserStorage) error { return fn(tx) })
+	}}
 }
 
-func NewStorage(db *sqlx.DB, l *zap.Logger) *Storage {
-	userStorage := postgre.NewUserStorage(db, l)
-	return &Storage{userStorage}
+// NewMemoryStorage returns a process-local backend for tests and local runs;
+// its data is lost on restart.
+func NewMemoryStorage(l *zap.Logger) *Storage {
+	l.Warn("using in-memory storage, data is not persisted")
+	userStorage := memory.NewUserStorage()
+	return &Storage{userStorage, memory.NewWebhookStorage(), func(ctx context.Context, fn func(tx IStorage) error) error {
+		return userStorage.WithTx(ctx, func(tx *memory.UserStorage) error { return fn(tx) })
+	}}
 }
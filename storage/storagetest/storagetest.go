@@ -0,0 +1,534 @@
+// Package storagetest is the conformance suite every storage backend must
+// pass. Backends call Run from their own tests with a constructor returning
+// an empty storage:
+//
+//	func TestStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) *storage.Storage {
+//			return storage.NewMemoryStorage(zap.NewNop())
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/model/dto"
+	"github.com/zhayt/user-service/storage"
+)
+
+// Run runs every conformance test against storages built by newStorage,
+// one fresh storage per subtest.
+func Run(t *testing.T, newStorage func(t *testing.T) *storage.Storage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *storage.Storage)
+	}{
+		{"CreateUser", testCreateUser},
+		{"UniqueEmailAndName", testUniqueEmailAndName},
+		{"GetUserNotFound", testGetUserNotFound},
+		{"GetUserByEmailIgnoresCase", testGetUserByEmailIgnoresCase},
+		{"GetUsersByIDs", testGetUsersByIDs},
+		{"SearchUsers", testSearchUsers},
+		{"UpdateLastLogin", testUpdateLastLogin},
+		{"UpdateUserName", testUpdateUserName},
+		{"UpdateUserPassword", testUpdateUserPassword},
+		{"VersionConflict", testVersionConflict},
+		{"WithTxCommits", testWithTxCommits},
+		{"WithTxRollsBack", testWithTxRollsBack},
+		{"WithTxSerializes", testWithTxSerializes},
+		{"Webhooks", testWebhooks},
+		{"DeadLetters", testDeadLetters},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t))
+		})
+	}
+}
+
+func testCreateUser(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+
+	user := newUser("alice")
+	id, err := s.CreateUser(ctx, user)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if id == 0 || user.ID != id {
+		t.Fatalf("CreateUser id = %d, user.ID = %d", id, user.ID)
+	}
+
+	if user.Version != 1 || user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+		t.Fatalf("CreateUser did not fill version and timestamps: %+v", user)
+	}
+
+	got, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+
+	if got.Name != user.Name || got.Email != user.Email || got.Password != user.Password || got.Version != 1 {
+		t.Fatalf("GetUserByID = %+v, want %+v", got, user)
+	}
+
+	if got.LastLoginAt != nil {
+		t.Fatalf("new user has last login %v", got.LastLoginAt)
+	}
+
+	other := mustCreate(t, s, "bob")
+	if other.ID == id {
+		t.Fatalf("users share id %d", id)
+	}
+}
+
+func testUniqueEmailAndName(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	mustCreate(t, s, "alice")
+
+	sameEmail := newUser("alicia")
+	sameEmail.Email = "ALICE@example.com"
+	if _, err := s.CreateUser(ctx, sameEmail); !errors.Is(err, errs.ErrConflict) {
+		t.Fatalf("CreateUser with taken email: err = %v, want ErrConflict", err)
+	}
+
+	sameName := newUser("Alice")
+	sameName.Email = "other@example.com"
+	if _, err := s.CreateUser(ctx, sameName); !errors.Is(err, errs.ErrConflict) {
+		t.Fatalf("CreateUser with taken name: err = %v, want ErrConflict", err)
+	}
+
+	bob := mustCreate(t, s, "bob")
+	_, err := s.UpdateUserName(ctx, &dto.ChangeUserNameDTO{ID: bob.ID, Name: "ALICE"})
+	if !errors.Is(err, errs.ErrConflict) {
+		t.Fatalf("UpdateUserName to taken name: err = %v, want ErrConflict", err)
+	}
+}
+
+func testGetUserNotFound(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+
+	if _, err := s.GetUserByID(ctx, 42); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("GetUserByID: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := s.GetUserByEmail(ctx, "nobody@example.com"); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("GetUserByEmail: err = %v, want ErrNotFound", err)
+	}
+
+	if err := s.UpdateLastLogin(ctx, 42); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("UpdateLastLogin: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testGetUserByEmailIgnoresCase(t *testing.T, s *storage.Storage) {
+	user := mustCreate(t, s, "alice")
+
+	got, err := s.GetUserByEmail(context.Background(), "Alice@Example.COM")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+
+	if got.ID != user.ID {
+		t.Fatalf("GetUserByEmail id = %d, want %d", got.ID, user.ID)
+	}
+}
+
+func testGetUsersByIDs(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	alice := mustCreate(t, s, "alice")
+	bob := mustCreate(t, s, "bob")
+
+	users, err := s.GetUsersByIDs(ctx, []uint64{bob.ID, alice.ID, 9999})
+	if err != nil {
+		t.Fatalf("GetUsersByIDs: %v", err)
+	}
+
+	assertIDs(t, users, alice.ID, bob.ID)
+
+	users, err = s.GetUsersByIDs(ctx, nil)
+	if err != nil || len(users) != 0 {
+		t.Fatalf("GetUsersByIDs(nil) = %v, %v", users, err)
+	}
+}
+
+func testSearchUsers(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	alice := mustCreate(t, s, "alice")
+	alicia := mustCreate(t, s, "alicia")
+	mustCreate(t, s, "bob")
+
+	users, err := s.SearchUsers(ctx, &model.UserFilter{Query: "ALI", Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchUsers: %v", err)
+	}
+	assertIDs(t, users, alice.ID, alicia.ID)
+
+	users, err = s.SearchUsers(ctx, &model.UserFilter{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("SearchUsers with offset: %v", err)
+	}
+	assertIDs(t, users, alicia.ID)
+
+	if err := s.UpdateLastLogin(ctx, alice.ID); err != nil {
+		t.Fatalf("UpdateLastLogin: %v", err)
+	}
+
+	hourAgo := time.Now().Add(-time.Hour)
+	users, err = s.SearchUsers(ctx, &model.UserFilter{LastLoginAfter: &hourAgo, Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchUsers by last login: %v", err)
+	}
+	assertIDs(t, users, alice.ID)
+
+	users, err = s.SearchUsers(ctx, &model.UserFilter{Query: "ali", LastLoginBefore: &hourAgo, Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchUsers by never logged in: %v", err)
+	}
+	assertIDs(t, users, alicia.ID)
+
+	future := time.Now().Add(time.Hour)
+	users, err = s.SearchUsers(ctx, &model.UserFilter{CreatedAfter: &future, Limit: 10})
+	if err != nil || len(users) != 0 {
+		t.Fatalf("SearchUsers created in the future = %v, %v", users, err)
+	}
+}
+
+func testUpdateLastLogin(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	if err := s.UpdateLastLogin(ctx, user.ID); err != nil {
+		t.Fatalf("UpdateLastLogin: %v", err)
+	}
+
+	got, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+
+	if got.LastLoginAt == nil {
+		t.Fatal("LastLoginAt not set")
+	}
+
+	if got.Version != user.Version {
+		t.Fatalf("UpdateLastLogin changed version to %d", got.Version)
+	}
+}
+
+func testUpdateUserName(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	version, err := s.UpdateUserName(ctx, &dto.ChangeUserNameDTO{ID: user.ID, Name: "alicia", ExpectedVersion: 1})
+	if err != nil {
+		t.Fatalf("UpdateUserName: %v", err)
+	}
+
+	if version != 2 {
+		t.Fatalf("UpdateUserName version = %d, want 2", version)
+	}
+
+	got, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+
+	if got.Name != "alicia" || got.Version != 2 || got.UpdatedAt.Before(user.UpdatedAt) {
+		t.Fatalf("GetUserByID after rename = %+v", got)
+	}
+}
+
+func testUpdateUserPassword(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	version, err := s.UpdateUserPassword(ctx, &dto.ChangeUserPasswordDTO{ID: user.ID, NewPassword: "new-hash"})
+	if err != nil {
+		t.Fatalf("UpdateUserPassword: %v", err)
+	}
+
+	if version != 2 {
+		t.Fatalf("UpdateUserPassword version = %d, want 2", version)
+	}
+
+	got, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+
+	if got.Password != "new-hash" {
+		t.Fatalf("password = %q, want new-hash", got.Password)
+	}
+}
+
+func testVersionConflict(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	_, err := s.UpdateUserName(ctx, &dto.ChangeUserNameDTO{ID: user.ID, Name: "alicia", ExpectedVersion: 7})
+	if !errors.Is(err, errs.ErrVersionConflict) {
+		t.Fatalf("UpdateUserName with stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	_, err = s.UpdateUserPassword(ctx, &dto.ChangeUserPasswordDTO{ID: user.ID, NewPassword: "x", ExpectedVersion: 7})
+	if !errors.Is(err, errs.ErrVersionConflict) {
+		t.Fatalf("UpdateUserPassword with stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	got, err := s.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+
+	if got.Name != "alice" || got.Version != 1 {
+		t.Fatalf("conflicting update was applied: %+v", got)
+	}
+}
+
+func testWithTxCommits(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	err := s.WithTx(ctx, func(tx storage.IStorage) error {
+		if _, err := tx.UpdateUserName(ctx, &dto.ChangeUserNameDTO{ID: user.ID, Name: "alicia"}); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateUser(ctx, newUser("bob"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	got, err := s.GetUserByID(ctx, user.ID)
+	if err != nil || got.Name != "alicia" {
+		t.Fatalf("GetUserByID after commit = %+v, %v", got, err)
+	}
+
+	if _, err := s.GetUserByEmail(ctx, "bob@example.com"); err != nil {
+		t.Fatalf("user created in transaction not committed: %v", err)
+	}
+}
+
+func testWithTxRollsBack(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+	errAbort := errors.New("abort")
+
+	err := s.WithTx(ctx, func(tx storage.IStorage) error {
+		if _, err := tx.UpdateUserName(ctx, &dto.ChangeUserNameDTO{ID: user.ID, Name: "alicia"}); err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateUser(ctx, newUser("bob")); err != nil {
+			return err
+		}
+
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx: err = %v, want the callback error", err)
+	}
+
+	got, err := s.GetUserByID(ctx, user.ID)
+	if err != nil || got.Name != "alice" || got.Version != 1 {
+		t.Fatalf("GetUserByID after rollback = %+v, %v", got, err)
+	}
+
+	if _, err := s.GetUserByEmail(ctx, "bob@example.com"); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("user created in rolled back transaction: err = %v, want ErrNotFound", err)
+	}
+
+	// the rolled back name is free again
+	mustCreate(t, s, "alicia")
+}
+
+// testWithTxSerializes runs concurrent read-check-write transactions that
+// each expect the version they read; none may see a stale version.
+func testWithTxSerializes(t *testing.T, s *storage.Storage) {
+	const workers = 8
+
+	ctx := context.Background()
+	user := mustCreate(t, s, "alice")
+
+	var wg sync.WaitGroup
+	errc := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			errc <- s.WithTx(ctx, func(tx storage.IStorage) error {
+				current, err := tx.GetUserByID(ctx, user.ID)
+				if err != nil {
+					return err
+				}
+
+				_, err = tx.UpdateUserName(ctx, &dto.ChangeUserNameDTO{
+					ID: user.ID, Name: fmt.Sprintf("alice%d", i), ExpectedVersion: current.Version,
+				})
+				return err
+			})
+		}(i)
+	}
+
+	wg.Wait()
+	close(errc)
+
+	for err := range errc {
+		if err != nil {
+			t.Fatalf("concurrent WithTx: %v", err)
+		}
+	}
+
+	got, err := s.GetUserByID(ctx, user.ID)
+	if err != nil || got.Version != workers+1 {
+		t.Fatalf("GetUserByID after %d updates = %+v, %v", workers, got, err)
+	}
+}
+
+func testWebhooks(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+
+	first := &model.Webhook{URL: "https://a.example.com", Secret: "0123456789abcdef", Events: []string{model.EventUserCreated}}
+	second := &model.Webhook{URL: "https://b.example.com", Secret: "0123456789abcdef",
+		Events: []string{model.EventUserCreated, model.EventUserNameUpdated}}
+
+	firstID, err := s.CreateWebhook(ctx, first)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	secondID, err := s.CreateWebhook(ctx, second)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	got, err := s.GetWebhookByID(ctx, secondID)
+	if err != nil {
+		t.Fatalf("GetWebhookByID: %v", err)
+	}
+
+	if got.URL != second.URL || got.Secret != second.Secret || len(got.Events) != 2 {
+		t.Fatalf("GetWebhookByID = %+v, want %+v", got, second)
+	}
+
+	webhooks, err := s.GetWebhooks(ctx)
+	if err != nil {
+		t.Fatalf("GetWebhooks: %v", err)
+	}
+
+	if len(webhooks) != 2 || webhooks[0].ID != firstID || webhooks[1].ID != secondID {
+		t.Fatalf("GetWebhooks = %+v, want ids %d, %d in order", webhooks, firstID, secondID)
+	}
+
+	if err := s.DeleteWebhook(ctx, firstID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+
+	if _, err := s.GetWebhookByID(ctx, firstID); !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("GetWebhookByID after delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testDeadLetters(t *testing.T, s *storage.Storage) {
+	ctx := context.Background()
+
+	webhookID, err := s.CreateWebhook(ctx, &model.Webhook{URL: "https://a.example.com", Secret: "0123456789abcdef",
+		Events: []string{model.EventUserCreated}})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	for _, eventType := range []string{model.EventUserCreated, model.EventUserNameUpdated} {
+		letter := &model.WebhookDeadLetter{WebhookID: webhookID, EventType: eventType, Payload: "{}", Attempts: 5, LastError: "timeout"}
+		if err := s.CreateDeadLetter(ctx, letter); err != nil {
+			t.Fatalf("CreateDeadLetter: %v", err)
+		}
+	}
+
+	letters, err := s.GetDeadLetters(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetDeadLetters: %v", err)
+	}
+
+	if len(letters) != 2 || letters[0].ID >= letters[1].ID || letters[0].EventType != model.EventUserCreated {
+		t.Fatalf("GetDeadLetters = %+v", letters)
+	}
+
+	if letters[0].Attempts != 5 || letters[0].LastError != "timeout" || letters[0].Payload != "{}" {
+		t.Fatalf("dead letter fields not stored: %+v", letters[0])
+	}
+
+	byID, err := s.GetDeadLettersByIDs(ctx, []uint64{letters[1].ID})
+	if err != nil || len(byID) != 1 || byID[0].ID != letters[1].ID {
+		t.Fatalf("GetDeadLettersByIDs = %+v, %v", byID, err)
+	}
+
+	if err := s.DeleteDeadLetter(ctx, letters[1].ID); err != nil {
+		t.Fatalf("DeleteDeadLetter: %v", err)
+	}
+
+	letters, err = s.GetDeadLetters(ctx, webhookID)
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("GetDeadLetters after delete = %+v, %v", letters, err)
+	}
+
+	if err := s.DeleteWebhook(ctx, webhookID); err != nil {
+		t.Fatalf("DeleteWebhook: %v", err)
+	}
+
+	letters, err = s.GetDeadLetters(ctx, 0)
+	if err != nil || len(letters) != 0 {
+		t.Fatalf("dead letters not deleted with their webhook: %+v, %v", letters, err)
+	}
+}
+
+func newUser(name string) *model.User {
+	return &model.User{Name: name, Email: name + "@example.com", Password: name + "-hash"}
+}
+
+func mustCreate(t *testing.T, s *storage.Storage, name string) *model.User {
+	t.Helper()
+
+	user := newUser(name)
+	if _, err := s.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("CreateUser(%s): %v", name, err)
+	}
+
+	return user
+}
+
+// assertIDs compares users with want regardless of order.
+func assertIDs(t *testing.T, users []*model.User, want ...uint64) {
+	t.Helper()
+
+	got := make([]uint64, 0, len(users))
+	for _, user := range users {
+		got = append(got, user.ID)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+
+	if len(got) != len(want) {
+		t.Fatalf("user ids = %v, want %v", got, want)
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("user ids = %v, want %v", got, want)
+		}
+	}
+}
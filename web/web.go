@@ -0,0 +1,71 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"connectrpc.com/vanguard"
+	"connectrpc.com/vanguard/vanguardgrpc"
+	"github.com/rs/cors"
+	"github.com/zhayt/user-service/config"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func init() {
+	// let JSON Connect requests pass through to the gRPC server untouched
+	encoding.RegisterCodec(vanguardgrpc.NewCodec(&vanguard.JSONCodec{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}))
+}
+
+// NewServer serves every service registered on grpcServer over the Connect
+// and gRPC-Web protocols for browser clients. Requests are handed to
+// grpcServer in-process, so they run through the same interceptors as
+// native gRPC calls. It must be called after all services are registered.
+func NewServer(grpcServer *grpc.Server, cfg *config.Config, l *zap.Logger) (*http.Server, error) {
+	transcoder, err := vanguardgrpc.NewTranscoder(grpcServer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create transcoder: %w", err)
+	}
+
+	handler := newCORS(cfg).Handler(transcoder)
+
+	l.Info("Connect and gRPC-Web enabled", zap.Strings("cors_origins", cfg.CORSAllowedOrigins))
+	return &http.Server{
+		Addr:              net.JoinHostPort("", cfg.WebPort),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}, nil
+}
+
+func newCORS(cfg *config.Config) *cors.Cors {
+	return cors.New(cors.Options{
+		AllowedOrigins: cfg.CORSAllowedOrigins,
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{
+			"Content-Type",
+			"Authorization",
+			"Connect-Protocol-Version",
+			"Connect-Timeout-Ms",
+			"Grpc-Timeout",
+			"X-Grpc-Web",
+			"X-User-Agent",
+			"X-Request-Id",
+			"X-Api-Key",
+		},
+		ExposedHeaders: []string{
+			"Grpc-Status",
+			"Grpc-Message",
+			"Grpc-Status-Details-Bin",
+			"X-Request-Id",
+		},
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           int(cfg.CORSMaxAge.Seconds()),
+	})
+}
@@ -0,0 +1,215 @@
+package web_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zhayt/user-service/config"
+	pb "github.com/zhayt/user-service/proto"
+	"github.com/zhayt/user-service/service/servicetest"
+	"github.com/zhayt/user-service/web"
+	"google.golang.org/protobuf/proto"
+)
+
+const _origin = "http://localhost:3000"
+
+// newWebServer serves Connect and gRPC-Web over HTTP in front of a gRPC
+// server with the production interceptor chain and in-memory storage.
+func newWebServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	f := servicetest.New(t, func(cfg *config.Config) {
+		cfg.CORSAllowedOrigins = []string{_origin}
+	})
+
+	srv, err := web.NewServer(f.GRPCServer(), f.Config, f.Logger)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	ts := httptest.NewServer(srv.Handler)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// connectCall posts a Connect unary JSON request and decodes the response.
+func connectCall(t *testing.T, ts *httptest.Server, method string, body interface{}, header http.Header) (int, map[string]interface{}) {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/micro_forum_proto.UserService/"+method, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var out map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("%s: decode response: %v", method, err)
+	}
+
+	return resp.StatusCode, out
+}
+
+func TestConnectCreateAndGetUser(t *testing.T) {
+	ts := newWebServer(t)
+
+	code, created := connectCall(t, ts, "CreateUser", map[string]string{
+		"name":     "carol",
+		"email":    "carol@example.com",
+		"password": "secret",
+	}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("CreateUser: status %d, body %v", code, created)
+	}
+
+	key := http.Header{"X-Api-Key": {servicetest.ServiceKey}}
+
+	code, user := connectCall(t, ts, "GetUserByID", map[string]interface{}{"id": created["id"]}, key)
+	if code != http.StatusOK || user["name"] != "carol" {
+		t.Fatalf("GetUserByID: status %d, body %v", code, user)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   interface{}
+		header http.Header
+		code   int
+		error  string
+	}{
+		{name: "not found", method: "GetUserByID", body: map[string]string{"id": "999"}, header: key, code: http.StatusNotFound, error: "not_found"},
+		{name: "unauthenticated", method: "GetUserByID", body: map[string]interface{}{"id": created["id"]}, code: http.StatusUnauthorized, error: "unauthenticated"},
+		{name: "already exists", method: "CreateUser", body: map[string]string{
+			"name":     "Carol",
+			"email":    "carol2@example.com",
+			"password": "secret",
+		}, code: http.StatusConflict, error: "already_exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := connectCall(t, ts, tt.method, tt.body, tt.header)
+			if code != tt.code || body["code"] != tt.error {
+				t.Errorf("status %d, body %v, want %d %s", code, body, tt.code, tt.error)
+			}
+		})
+	}
+}
+
+func TestGRPCWebGetUser(t *testing.T) {
+	ts := newWebServer(t)
+
+	msg, err := proto.Marshal(&pb.GetUserByIDReq{Id: 999})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// a gRPC-Web message frame: flags byte, big-endian length, message
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/micro_forum_proto.UserService/GetUserByID", bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("X-Api-Key", servicetest.ServiceKey)
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	// gRPC-Web always answers 200 and reports the status in the trailers,
+	// sent as headers when there is no message
+	status := resp.Header.Get("Grpc-Status")
+	if status == "" {
+		status = string(trailer(body, "grpc-status"))
+	}
+
+	if resp.StatusCode != http.StatusOK || status != "5" {
+		t.Errorf("status %d, grpc-status %q, want 200 and 5 (NotFound)", resp.StatusCode, status)
+	}
+}
+
+// trailer extracts a value from the trailer frame of a gRPC-Web body.
+func trailer(body []byte, key string) []byte {
+	for len(body) >= 5 {
+		size := binary.BigEndian.Uint32(body[1:5])
+		if int(size) > len(body)-5 {
+			return nil
+		}
+
+		frame := body[5 : 5+size]
+		if body[0]&0x80 != 0 {
+			for _, line := range bytes.Split(frame, []byte("\r\n")) {
+				if k, v, ok := bytes.Cut(line, []byte(":")); ok && string(bytes.ToLower(k)) == key {
+					return bytes.TrimSpace(v)
+				}
+			}
+		}
+
+		body = body[5+size:]
+	}
+
+	return nil
+}
+
+func TestCORSPreflight(t *testing.T) {
+	ts := newWebServer(t)
+
+	for _, tt := range []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: _origin, allowed: true},
+		{origin: "https://evil.example.com", allowed: false},
+	} {
+		req, err := http.NewRequest(http.MethodOptions, ts.URL+"/micro_forum_proto.UserService/CreateUser", nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+
+		req.Header.Set("Origin", tt.origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,connect-protocol-version")
+
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("preflight: %v", err)
+		}
+		resp.Body.Close()
+
+		got := resp.Header.Get("Access-Control-Allow-Origin")
+		if allowed := got == tt.origin; allowed != tt.allowed {
+			t.Errorf("origin %s: Access-Control-Allow-Origin = %q, want allowed %v", tt.origin, got, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/errs"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	_maxBackoff = time.Minute
+	// _storageTimeout bounds each storage call of a job, which no longer
+	// follows the cancellation of Run
+	_storageTimeout = 10 * time.Second
+)
+
+var (
+	errNonRetryable = errors.New("non-retryable response")
+	errShutdown     = errors.New("dispatcher stopped before delivery")
+)
+
+// job is a single delivery, or a fan-out to all subscribers when webhookID
+// is zero.
+type job struct {
+	webhookID uint64
+	eventType string
+	payload   []byte
+	// deadLetterID is set when the job replays a dead letter, which is
+	// removed once the delivery succeeds.
+	deadLetterID uint64
+}
+
+// Dispatcher delivers user events to subscribed webhooks. Publish only
+// enqueues; delivery happens in the workers started by Run, so RPC handlers
+// are never blocked by slow receivers.
+type Dispatcher struct {
+	storage     storage.IWebhookStorage
+	client      *http.Client
+	queue       chan job
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+	l           *zap.Logger
+
+	// replaying holds the dead letters queued by Replay and not yet
+	// settled, so replaying twice does not deliver an event twice
+	mu        sync.Mutex
+	replaying map[uint64]struct{}
+}
+
+func NewDispatcher(storage storage.IWebhookStorage, client *http.Client, cfg *config.Config, l *zap.Logger) *Dispatcher {
+	return &Dispatcher{
+		storage:     storage,
+		client:      client,
+		queue:       make(chan job, cfg.WebhookQueueSize),
+		workers:     cfg.WebhookWorkers,
+		maxAttempts: cfg.WebhookMaxAttempts,
+		backoff:     cfg.WebhookBackoff,
+		l:           l,
+		replaying:   make(map[uint64]struct{}),
+	}
+}
+
+// Publish queues the event for every webhook subscribed to eventType. The
+// subscriber lookup happens on a worker, so the caller never waits on
+// storage unless the queue is full and the event has to be dead-lettered.
+func (d *Dispatcher) Publish(ctx context.Context, eventType string, data interface{}) {
+	payload, err := json.Marshal(model.WebhookEvent{
+		ID:         newEventID(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		d.l.Error("json.Marshal error", zap.Error(err))
+		return
+	}
+
+	j := job{eventType: eventType, payload: payload}
+
+	select {
+	case d.queue <- j:
+	default:
+		// fan out here so every subscriber gets a replayable dead letter
+		d.l.Warn("webhook queue is full, dead-lettering event", zap.String("event", eventType))
+		d.fanOut(ctx, j, d.enqueue)
+	}
+}
+
+// Replay re-enqueues the given dead letters, or all of them when ids is
+// empty, and returns how many were queued. Letters still queued by an earlier
+// Replay are skipped.
+func (d *Dispatcher) Replay(ctx context.Context, ids []uint64) (int, error) {
+	var (
+		letters []*model.WebhookDeadLetter
+		err     error
+	)
+
+	if len(ids) == 0 {
+		letters, err = d.storage.GetDeadLetters(ctx, 0)
+	} else {
+		letters, err = d.storage.GetDeadLettersByIDs(ctx, ids)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, letter := range letters {
+		if !d.claim(letter.ID) {
+			continue
+		}
+
+		d.enqueue(ctx, job{
+			webhookID:    letter.WebhookID,
+			eventType:    letter.EventType,
+			payload:      []byte(letter.Payload),
+			deadLetterID: letter.ID,
+		})
+		queued++
+	}
+
+	return queued, nil
+}
+
+// claim marks a dead letter as being replayed and reports whether it was
+// free; release frees it once the replay has settled.
+func (d *Dispatcher) claim(deadLetterID uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.replaying[deadLetterID]; ok {
+		return false
+	}
+
+	d.replaying[deadLetterID] = struct{}{}
+	return true
+}
+
+func (d *Dispatcher) release(deadLetterID uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.replaying, deadLetterID)
+}
+
+// Run starts the delivery workers and blocks until ctx is cancelled, the
+// workers have finished their current job and the jobs still queued have
+// been dead-lettered for replay.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.queue:
+					if ctx.Err() != nil {
+						// taken as Run stops; park it like the rest of the queue
+						d.park(j)
+						continue
+					}
+					if j.webhookID == 0 {
+						d.fanOut(ctx, j, d.enqueue)
+						continue
+					}
+					d.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	d.drain()
+}
+
+// drain dead-letters the queued jobs once the workers have stopped.
+func (d *Dispatcher) drain() {
+	for {
+		select {
+		case j := <-d.queue:
+			d.park(j)
+		default:
+			return
+		}
+	}
+}
+
+// park dead-letters a job that will not be delivered because Run stopped.
+func (d *Dispatcher) park(j job) {
+	// ctx is cancelled by now, but the dead letters must still be written
+	ctx := context.Background()
+	deadLetter := func(ctx context.Context, j job) {
+		d.deadLetter(ctx, j, 0, errShutdown)
+	}
+
+	if j.webhookID == 0 {
+		d.fanOut(ctx, j, deadLetter)
+		return
+	}
+	deadLetter(ctx, j)
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, j job) {
+	select {
+	case d.queue <- j:
+	default:
+		// the queue is full; park the event instead of blocking the caller
+		d.deadLetter(ctx, j, 0, errors.New("delivery queue is full"))
+	}
+}
+
+// fanOut hands a copy of the job to send for every subscribed webhook.
+func (d *Dispatcher) fanOut(ctx context.Context, j job, send func(context.Context, job)) {
+	lookupCtx, cancel := storageContext(ctx)
+	webhooks, err := d.storage.GetWebhooks(lookupCtx)
+	cancel()
+	if err != nil {
+		// without the subscribers there is nothing to dead-letter against
+		d.l.Error("GetWebhooks error", zap.String("event", j.eventType), zap.Error(err))
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(j.eventType) {
+			continue
+		}
+
+		send(ctx, job{webhookID: webhook.ID, eventType: j.eventType, payload: j.payload})
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	if j.deadLetterID != 0 {
+		defer d.release(j.deadLetterID)
+	}
+
+	lookupCtx, cancel := storageContext(ctx)
+	webhook, err := d.storage.GetWebhookByID(lookupCtx, j.webhookID)
+	cancel()
+	if errors.Is(err, errs.ErrNotFound) {
+		// the webhook was deleted along with its dead letters
+		d.l.Warn("webhook is gone, dropping event", zap.Uint64("webhook_id", j.webhookID))
+		return
+	}
+	if err != nil {
+		d.l.Error("GetWebhookByID error", zap.Uint64("webhook_id", j.webhookID), zap.Error(err))
+		d.deadLetter(ctx, j, 0, err)
+		return
+	}
+
+	attempts, err := d.postWithRetry(ctx, webhook, j)
+	if err != nil {
+		// shutting down mid-retry still parks the event so it can be replayed
+		d.deadLetter(ctx, j, attempts, err)
+		return
+	}
+
+	if j.deadLetterID != 0 {
+		deleteCtx, cancel := storageContext(ctx)
+		defer cancel()
+
+		if err = d.storage.DeleteDeadLetter(deleteCtx, j.deadLetterID); err != nil {
+			d.l.Error("DeleteDeadLetter error", zap.Uint64("id", j.deadLetterID), zap.Error(err))
+		}
+	}
+
+	d.l.Info("webhook delivered", zap.Uint64("webhook_id", webhook.ID), zap.String("event", j.eventType))
+}
+
+// postWithRetry posts the job until it succeeds, fails permanently or runs
+// out of attempts, and returns the number of attempts made.
+func (d *Dispatcher) postWithRetry(ctx context.Context, webhook *model.Webhook, j job) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := d.post(ctx, webhook, j)
+		if err == nil {
+			return attempt, nil
+		}
+
+		d.l.Warn("webhook delivery failed", zap.Uint64("webhook_id", webhook.ID),
+			zap.Int("attempt", attempt), zap.Error(err))
+
+		if errors.Is(err, errNonRetryable) || attempt >= d.maxAttempts {
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(d.backoffFor(attempt)):
+		}
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, webhook *model.Webhook, j job) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(j.payload))
+	if err != nil {
+		return fmt.Errorf("%w: %s", errNonRetryable, err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, j.eventType)
+	req.Header.Set(HeaderID, strconv.FormatUint(webhook.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, j.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot post event: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: status %d", errNonRetryable, resp.StatusCode)
+	default:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func (d *Dispatcher) deadLetter(ctx context.Context, j job, attempts int, cause error) {
+	if j.deadLetterID != 0 {
+		// a failed replay keeps its original dead letter
+		d.release(j.deadLetterID)
+		return
+	}
+
+	letter := &model.WebhookDeadLetter{
+		WebhookID: j.webhookID,
+		EventType: j.eventType,
+		Payload:   string(j.payload),
+		Attempts:  uint32(attempts),
+		LastError: cause.Error(),
+	}
+
+	ctx, cancel := storageContext(ctx)
+	defer cancel()
+
+	if err := d.storage.CreateDeadLetter(ctx, letter); err != nil {
+		d.l.Error("CreateDeadLetter error", zap.Uint64("webhook_id", j.webhookID), zap.Error(err))
+	}
+}
+
+func (d *Dispatcher) backoffFor(attempt int) time.Duration {
+	backoff := d.backoff << (attempt - 1)
+	if backoff <= 0 || backoff > _maxBackoff {
+		return _maxBackoff
+	}
+
+	return backoff
+}
+
+// storageContext returns a context for the storage calls of a job that
+// keeps the values of ctx but not its cancellation, so a job interrupted by
+// shutdown can still be looked up and dead-lettered.
+func storageContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detached{ctx}, _storageTimeout)
+}
+
+// detached is context.WithoutCancel, which needs go 1.21.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
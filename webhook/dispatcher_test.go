@@ -0,0 +1,473 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhayt/user-service/config"
+	"github.com/zhayt/user-service/model"
+	"github.com/zhayt/user-service/storage"
+	"github.com/zhayt/user-service/webhook"
+	"go.uber.org/zap"
+)
+
+const _secret = "test-secret"
+
+// receiver is an httptest server that answers with the next status from
+// statuses, repeating the last one, and records what it received.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	times    []time.Time
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+
+		rcv.requests = append(rcv.requests, r)
+		rcv.bodies = append(rcv.bodies, body)
+		rcv.times = append(rcv.times, time.Now())
+
+		status := rcv.statuses[0]
+		if len(rcv.statuses) > 1 {
+			rcv.statuses = rcv.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+
+	return rcv
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statuses = []int{status}
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.requests)
+}
+
+type fixture struct {
+	storage    *storage.Storage
+	dispatcher *webhook.Dispatcher
+	webhookID  uint64
+}
+
+func newFixture(t *testing.T, url string, cfg *config.Config) *fixture {
+	t.Helper()
+
+	repo := storage.NewMemoryStorage(zap.NewNop())
+	id, err := repo.CreateWebhook(context.Background(), &model.Webhook{
+		URL:    url,
+		Secret: _secret,
+		Events: []string{model.EventUserCreated},
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	return &fixture{
+		storage:    repo,
+		dispatcher: webhook.NewDispatcher(repo, &http.Client{Timeout: time.Second}, cfg, zap.NewNop()),
+		webhookID:  id,
+	}
+}
+
+// run starts the dispatcher until the test ends.
+func (f *fixture) run(t *testing.T) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func (f *fixture) deadLetters(t *testing.T) []*model.WebhookDeadLetter {
+	t.Helper()
+
+	letters, err := f.storage.GetDeadLetters(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("GetDeadLetters: %v", err)
+	}
+
+	return letters
+}
+
+func newConfig() *config.Config {
+	return &config.Config{
+		WebhookWorkers:     2,
+		WebhookQueueSize:   16,
+		WebhookMaxAttempts: 3,
+		WebhookBackoff:     20 * time.Millisecond,
+	}
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	rcv := newReceiver(t, http.StatusOK)
+	f := newFixture(t, rcv.URL, newConfig())
+	f.run(t)
+
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 7, Name: "alice"})
+	eventually(t, func() bool { return rcv.count() == 1 })
+
+	rcv.mu.Lock()
+	req, body := rcv.requests[0], rcv.bodies[0]
+	rcv.mu.Unlock()
+
+	if got := req.Header.Get(webhook.HeaderEvent); got != model.EventUserCreated {
+		t.Errorf("%s = %q, want %q", webhook.HeaderEvent, got, model.EventUserCreated)
+	}
+
+	if got := req.Header.Get(webhook.HeaderID); got != strconv.FormatUint(f.webhookID, 10) {
+		t.Errorf("%s = %q, want %d", webhook.HeaderID, got, f.webhookID)
+	}
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(webhook.HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", webhook.HeaderTimestamp, err)
+	}
+
+	if !webhook.Verify(_secret, timestamp, body, req.Header.Get(webhook.HeaderSignature)) {
+		t.Error("signature does not verify")
+	}
+
+	if webhook.Verify("other-secret", timestamp, body, req.Header.Get(webhook.HeaderSignature)) {
+		t.Error("signature verifies with the wrong secret")
+	}
+
+	var event model.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+
+	if event.Type != model.EventUserCreated || event.ID == "" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	rcv := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	cfg := newConfig()
+	f := newFixture(t, rcv.URL, cfg)
+	f.run(t)
+
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 1})
+	eventually(t, func() bool { return rcv.count() == 3 })
+
+	rcv.mu.Lock()
+	times := rcv.times
+	rcv.mu.Unlock()
+
+	// the backoff doubles after every failed attempt
+	for i, want := range []time.Duration{cfg.WebhookBackoff, 2 * cfg.WebhookBackoff} {
+		if got := times[i+1].Sub(times[i]); got < want {
+			t.Errorf("wait before attempt %d = %v, want at least %v", i+2, got, want)
+		}
+	}
+
+	if letters := f.deadLetters(t); len(letters) != 0 {
+		t.Errorf("got %d dead letters after a successful retry", len(letters))
+	}
+}
+
+func TestDeliverDeadLettersAfterMaxAttempts(t *testing.T) {
+	rcv := newReceiver(t, http.StatusInternalServerError)
+	cfg := newConfig()
+	f := newFixture(t, rcv.URL, cfg)
+	f.run(t)
+
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 1})
+	eventually(t, func() bool { return len(f.deadLetters(t)) == 1 })
+
+	letter := f.deadLetters(t)[0]
+	if letter.WebhookID != f.webhookID || letter.EventType != model.EventUserCreated {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+
+	if letter.Attempts != uint32(cfg.WebhookMaxAttempts) || rcv.count() != cfg.WebhookMaxAttempts {
+		t.Errorf("attempts = %d, requests = %d, want %d", letter.Attempts, rcv.count(), cfg.WebhookMaxAttempts)
+	}
+}
+
+func TestDeliverDoesNotRetryClientErrors(t *testing.T) {
+	rcv := newReceiver(t, http.StatusGone)
+	f := newFixture(t, rcv.URL, newConfig())
+	f.run(t)
+
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 1})
+	eventually(t, func() bool { return len(f.deadLetters(t)) == 1 })
+
+	if got := rcv.count(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestPublishDeadLettersWhenQueueIsFull(t *testing.T) {
+	rcv := newReceiver(t, http.StatusOK)
+	cfg := newConfig()
+	cfg.WebhookQueueSize = 1
+	f := newFixture(t, rcv.URL, cfg)
+
+	// nothing drains the queue yet, so the second event overflows it
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 1})
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 2})
+
+	letters := f.deadLetters(t)
+	if len(letters) != 1 || letters[0].WebhookID != f.webhookID {
+		t.Fatalf("got dead letters %+v, want one for webhook %d", letters, f.webhookID)
+	}
+
+	f.run(t)
+	eventually(t, func() bool { return rcv.count() == 1 })
+
+	if n, err := f.dispatcher.Replay(context.Background(), nil); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v, want 1", n, err)
+	}
+
+	eventually(t, func() bool { return rcv.count() == 2 && len(f.deadLetters(t)) == 0 })
+}
+
+func TestReplayDeliversAndDeletesDeadLetter(t *testing.T) {
+	rcv := newReceiver(t, http.StatusInternalServerError)
+	cfg := newConfig()
+	f := newFixture(t, rcv.URL, cfg)
+	f.run(t)
+
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 1})
+	eventually(t, func() bool { return len(f.deadLetters(t)) == 1 })
+
+	letter := f.deadLetters(t)[0]
+	sent := rcv.count()
+
+	if n, err := f.dispatcher.Replay(context.Background(), []uint64{letter.ID}); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v, want 1", n, err)
+	}
+	eventually(t, func() bool { return rcv.count() == sent+cfg.WebhookMaxAttempts })
+
+	// a failed replay keeps the original dead letter
+	if letters := f.deadLetters(t); len(letters) != 1 || letters[0].ID != letter.ID {
+		t.Fatalf("got dead letters %+v after a failed replay, want %d", letters, letter.ID)
+	}
+
+	rcv.setStatus(http.StatusOK)
+
+	// the failed replay settles right after its last attempt
+	eventually(t, func() bool {
+		n, err := f.dispatcher.Replay(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("Replay: %v", err)
+		}
+		return n == 1
+	})
+	eventually(t, func() bool { return len(f.deadLetters(t)) == 0 })
+
+	rcv.mu.Lock()
+	last := rcv.bodies[len(rcv.bodies)-1]
+	rcv.mu.Unlock()
+
+	if string(last) != letter.Payload {
+		t.Errorf("replayed payload %s, want %s", last, letter.Payload)
+	}
+}
+
+func TestReplaySkipsLettersAlreadyQueued(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	t.Cleanup(srv.Close)
+
+	f := newFixture(t, srv.URL, newConfig())
+	err := f.storage.CreateDeadLetter(context.Background(), &model.WebhookDeadLetter{
+		WebhookID: f.webhookID,
+		EventType: model.EventUserCreated,
+		Payload:   `{}`,
+		Attempts:  1,
+		LastError: "unexpected status 500",
+	})
+	if err != nil {
+		t.Fatalf("CreateDeadLetter: %v", err)
+	}
+
+	// the dispatcher is not running, so the first replay is still queued
+	if n, err := f.dispatcher.Replay(context.Background(), nil); err != nil || n != 1 {
+		t.Fatalf("first Replay = %d, %v, want 1", n, err)
+	}
+
+	if n, err := f.dispatcher.Replay(context.Background(), nil); err != nil || n != 0 {
+		t.Fatalf("second Replay = %d, %v, want 0", n, err)
+	}
+
+	f.run(t)
+	eventually(t, func() bool { return len(f.deadLetters(t)) == 0 })
+
+	// give a duplicate delivery the chance to show up
+	time.Sleep(50 * time.Millisecond)
+	if got := hits.Load(); got != 1 {
+		t.Errorf("got %d deliveries, want 1", got)
+	}
+}
+
+func TestRunDeadLettersQueuedEventsOnShutdown(t *testing.T) {
+	rcv := newReceiver(t, http.StatusOK)
+	f := newFixture(t, rcv.URL, newConfig())
+
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 1})
+	f.dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 2})
+
+	// stopped before it starts, so nothing may be delivered
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f.dispatcher.Run(ctx)
+
+	if got := rcv.count(); got != 0 {
+		t.Errorf("got %d deliveries after shutdown", got)
+	}
+
+	letters := f.deadLetters(t)
+	if len(letters) != 2 {
+		t.Fatalf("got %d dead letters, want 2", len(letters))
+	}
+
+	// the parked events are replayed once the dispatcher runs again
+	f.run(t)
+	if n, err := f.dispatcher.Replay(context.Background(), nil); err != nil || n != 2 {
+		t.Fatalf("Replay = %d, %v, want 2", n, err)
+	}
+
+	eventually(t, func() bool { return rcv.count() == 2 && len(f.deadLetters(t)) == 0 })
+}
+
+// ctxStore fails every call made with a cancelled context, as the SQL
+// backends do. GetWebhookByID waits for lookup to be closed, and fails with
+// lookupErr when it is set.
+type ctxStore struct {
+	storage.IWebhookStorage
+
+	looking   chan struct{}
+	lookup    chan struct{}
+	lookupErr error
+}
+
+func (s *ctxStore) GetWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.IWebhookStorage.GetWebhooks(ctx)
+}
+
+func (s *ctxStore) GetWebhookByID(ctx context.Context, id uint64) (*model.Webhook, error) {
+	close(s.looking)
+	<-s.lookup
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.lookupErr != nil {
+		return nil, s.lookupErr
+	}
+	return s.IWebhookStorage.GetWebhookByID(ctx, id)
+}
+
+func (s *ctxStore) CreateDeadLetter(ctx context.Context, letter *model.WebhookDeadLetter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.IWebhookStorage.CreateDeadLetter(ctx, letter)
+}
+
+func TestRunDeadLettersJobsInterruptedByShutdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		lookupErr error
+	}{
+		{name: "lookup outlives shutdown"},
+		{name: "lookup fails", lookupErr: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := newReceiver(t, http.StatusOK)
+			cfg := newConfig()
+			cfg.WebhookWorkers = 1
+			f := newFixture(t, rcv.URL, cfg)
+
+			store := &ctxStore{
+				IWebhookStorage: f.storage,
+				looking:         make(chan struct{}),
+				lookup:          make(chan struct{}),
+				lookupErr:       tt.lookupErr,
+			}
+			dispatcher := webhook.NewDispatcher(store, &http.Client{Timeout: time.Second}, cfg, zap.NewNop())
+			dispatcher.Publish(context.Background(), model.EventUserCreated, model.UserEventData{ID: 1})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				dispatcher.Run(ctx)
+				close(done)
+			}()
+
+			// stop while the worker is looking the webhook up
+			<-store.looking
+			cancel()
+			close(store.lookup)
+			<-done
+
+			if got := rcv.count(); got != 0 {
+				t.Errorf("got %d deliveries after shutdown", got)
+			}
+
+			letters := f.deadLetters(t)
+			if len(letters) != 1 || letters[0].WebhookID != f.webhookID {
+				t.Fatalf("dead letters = %+v, want one for webhook %d", letters, f.webhookID)
+			}
+		})
+	}
+}